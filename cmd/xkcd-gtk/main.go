@@ -11,15 +11,17 @@ import (
 	"github.com/gotk3/gotk3/gtk"
 	"github.com/rkoesters/xkcd-gtk/internal/app"
 	"github.com/rkoesters/xkcd-gtk/internal/build"
+	"github.com/rkoesters/xkcd-gtk/internal/cache"
 	"github.com/rkoesters/xkcd-gtk/internal/log"
 	"github.com/rkoesters/xkcd-gtk/internal/paths"
 )
 
 var (
-	gdkDebug = flag.String("gdk-debug", "", "Behave as if the GDK_DEBUG env variable was set to the provided string.")
-	gtkDebug = flag.String("gtk-debug", "", "Behave as if the GTK_DEBUG env variable was set to the provided string.")
-	service  = flag.Bool("gapplication-service", false, "Start in GApplication service mode.")
-	version  = flag.Bool("version", false, "Print app version and exit.")
+	gdkDebug      = flag.String("gdk-debug", "", "Behave as if the GDK_DEBUG env variable was set to the provided string.")
+	gtkDebug      = flag.String("gtk-debug", "", "Behave as if the GTK_DEBUG env variable was set to the provided string.")
+	service       = flag.Bool("gapplication-service", false, "Start in GApplication service mode.")
+	version       = flag.Bool("version", false, "Print app version and exit.")
+	migrateDryRun = flag.Bool("migrate-cache-dry-run", false, "Check whether the comic cache can be upgraded to this version of the app without changing it, then exit.")
 )
 
 func usage() {
@@ -48,6 +50,15 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *migrateDryRun {
+		err := cache.MigrateDryRun()
+		if err != nil {
+			log.Fatal("comic cache can not be upgraded: ", err)
+		}
+		fmt.Println("comic cache can be upgraded")
+		os.Exit(0)
+	}
+
 	if *gdkDebug != "" {
 		os.Setenv("GDK_DEBUG", *gdkDebug)
 	}
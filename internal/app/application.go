@@ -2,6 +2,7 @@
 package app
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"os"
@@ -30,8 +31,9 @@ func Name() string { return widget.AppName() }
 type Application struct {
 	*gtk.Application
 
-	gtkSettings *gtk.Settings
-	actions     map[string]*glib.SimpleAction
+	gtkSettings    *gtk.Settings
+	networkMonitor *glib.Object // GNetworkMonitor, may be nil.
+	actions        map[string]*glib.SimpleAction
 
 	aboutDialog      *gtk.AboutDialog
 	shortcutsWindow  *gtk.ShortcutsWindow
@@ -40,7 +42,7 @@ type Application struct {
 
 	settings    state.Application
 	bookmarks   bookmarks.List
-	searchIndex search.Index
+	searchIndex *search.Index
 }
 
 // New creates an instance of our GTK Application.
@@ -146,23 +148,55 @@ func (app *Application) SetupCache() {
 	log.Debug("SetupCache() start")
 	defer log.Debug("SetupCache() end")
 
-	log.Debug("Initializing comic cache")
-	err := cache.Init(app.searchIndex.Index)
-	if err != nil {
-		log.Fatal("error initializing comic cache: ", err)
-	}
-
 	paths.CheckForMisplacedSearchIndex()
 	sipath := paths.SearchIndex()
 	log.Debugf("Initializing search index %q", sipath)
+	var err error
 	app.searchIndex, err = search.New(sipath)
 	if err != nil {
 		log.Fatalf("error initializing search index %q: %v", sipath, err)
 	}
 
+	log.Debug("Initializing comic cache")
+	err = cache.Init(app.searchIndex.Index, app.searchIndex.Delete)
+	if err != nil {
+		log.Fatal("error initializing comic cache: ", err)
+	}
+
+	// Bookmarked comics should always be available, no matter how full the
+	// image cache gets.
+	cache.SetEvictionExemptions(app.bookmarks.Contains)
+	cache.SetOffline(app.settings.Offline)
+	app.MonitorNetwork()
+	err = cache.SetImageQuota(app.settings.ImageCacheQuota)
+	if err != nil {
+		log.Print("error applying image cache quota: ", err)
+	}
+
 	// Asynchronously fill the comic metadata cache and search index.
 	log.Debug("Filling comic metadata cache and search index in the background")
-	go cache.DownloadAllComicMetadata(app.CacheWindowVRW)
+	go func() {
+		app.checkSearchIndex()
+		cache.DownloadAllComicMetadata()
+	}()
+
+	// Keep the cached comic metadata up to date with corrections.
+	cache.StartRevalidation()
+}
+
+// checkSearchIndex adds the cached comics that are missing from the search
+// index, for example because the search index was deleted. Should not be
+// called directly in the UI event loop.
+func (app *Application) checkSearchIndex() {
+	count, err := app.searchIndex.Count()
+	if err != nil {
+		log.Print("error counting comics in search index: ", err)
+		return
+	}
+	err = cache.IndexMissingComics(context.Background(), count, app.searchIndex.Contains)
+	if err != nil {
+		log.Print("error indexing missing comics: ", err)
+	}
 }
 
 // CloseCache closes the search index and comic cache.
@@ -170,6 +204,11 @@ func (app *Application) CloseCache() {
 	log.Debug("CloseCache() start")
 	defer log.Debug("CloseCache() end")
 
+	// Stop any in-flight downloads before closing the search index and the
+	// comic cache that they write to.
+	log.Debug("Cancelling in-flight cache operations")
+	cache.Cancel()
+
 	log.Debug("Closing the search index")
 	err := app.searchIndex.Close()
 	if err != nil {
@@ -350,7 +389,7 @@ func (app *Application) BookmarksList() *bookmarks.List {
 
 // SearchIndex returns a pointer to the app's search index.
 func (app *Application) SearchIndex() *search.Index {
-	return &app.searchIndex
+	return app.searchIndex
 }
 
 // ShowShortcuts shows a shortcuts window to the user.
@@ -398,13 +437,39 @@ func (app *Application) ShowCache() {
 	app.cacheWindow.Present()
 }
 
-func (app *Application) CacheWindowVR() cache.ViewRefresher {
-	app.cacheWindowMutex.RLock()
-	defer app.cacheWindowMutex.RUnlock()
-	return app.cacheWindow
+// Offline returns whether the user asked the app not to use the network.
+func (app *Application) Offline() bool {
+	return cache.OfflineRequested()
+}
+
+// SetOffline turns offline mode on or off.
+func (app *Application) SetOffline(offline bool) {
+	app.settings.Offline = offline
+	cache.SetOffline(offline)
+}
+
+// ImageCacheQuota returns the maximum size of the comic image cache in bytes.
+// Zero means unlimited.
+func (app *Application) ImageCacheQuota() int64 {
+	return app.settings.ImageCacheQuota
+}
+
+// SetImageCacheQuota changes the maximum size of the comic image cache in
+// bytes, evicting images in the background if needed. Zero means unlimited.
+func (app *Application) SetImageCacheQuota(quota int64) {
+	app.settings.ImageCacheQuota = quota
+	go func() {
+		err := cache.SetImageQuota(quota)
+		if err != nil {
+			log.Print("error applying image cache quota: ", err)
+		}
+		app.currentCacheWindow().RefreshImages()
+	}()
 }
 
-func (app *Application) CacheWindowVRW() cache.ViewRefreshWither {
+// currentCacheWindow returns the cache window, or nil if it has not been
+// created yet.
+func (app *Application) currentCacheWindow() *widget.CacheWindow {
 	app.cacheWindowMutex.RLock()
 	defer app.cacheWindowMutex.RUnlock()
 	return app.cacheWindow
@@ -0,0 +1,45 @@
+package app
+
+// #cgo pkg-config: gio-2.0
+// #include <gio/gio.h>
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/rkoesters/xkcd-gtk/internal/cache"
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+)
+
+// networkMonitorDefault returns the system's default GNetworkMonitor, which
+// gotk3 does not wrap.
+func networkMonitorDefault() *glib.Object {
+	c := C.g_network_monitor_get_default()
+	if c == nil {
+		return nil
+	}
+	return glib.Take(unsafe.Pointer(c))
+}
+
+// MonitorNetwork keeps the comic cache informed about whether the system has a
+// network connection.
+func (app *Application) MonitorNetwork() {
+	app.networkMonitor = networkMonitorDefault()
+	if app.networkMonitor == nil {
+		log.Print("error getting network monitor")
+		return
+	}
+
+	available, err := app.networkMonitor.GetProperty("network-available")
+	if err != nil {
+		log.Print("error getting network availability: ", err)
+	} else if available, ok := available.(bool); ok {
+		cache.SetNetworkAvailable(available)
+	}
+
+	app.networkMonitor.Connect("network-changed", func(_ *glib.Object, available bool) {
+		log.Debugf("network-changed: available = %v", available)
+		cache.SetNetworkAvailable(available)
+	})
+}
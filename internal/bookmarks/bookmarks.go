@@ -17,6 +17,9 @@ import (
 // List holds the user's comic bookmarks.
 type List struct {
 	set *treeset.Set
+	// setMutex guards set, which is read outside the UI event loop (e.g. by
+	// the image cache to decide which images to keep).
+	setMutex sync.RWMutex
 
 	observerMutex   sync.RWMutex
 	observerCounter int
@@ -32,27 +35,36 @@ func New() List {
 
 // Add adds the comic number to the bookmarks set.
 func (list *List) Add(n int) {
+	list.setMutex.Lock()
 	list.set.Add(n)
+	list.setMutex.Unlock()
 	list.notifyObservers("added bookmark " + strconv.Itoa(n))
 }
 
 // Remove removes the comic number from the bookmarks set.
 func (list *List) Remove(n int) {
+	list.setMutex.Lock()
 	list.set.Remove(n)
+	list.setMutex.Unlock()
 	list.notifyObservers("removed bookmark " + strconv.Itoa(n))
 }
 
 // Contains indicates whether the comic specified by n is bookmarked.
 func (list *List) Contains(n int) bool {
+	list.setMutex.RLock()
+	defer list.setMutex.RUnlock()
 	return list.set.Contains(n)
 }
 
 // Empty returns true if there are exactly 0 bookmarks.
 func (list *List) Empty() bool {
+	list.setMutex.RLock()
+	defer list.setMutex.RUnlock()
 	return list.set.Empty()
 }
 
-// Iterator returns a treeset.Iterator for iterating through the bookmarks.
+// Iterator returns a treeset.Iterator for iterating through the bookmarks. The
+// bookmarks must not be changed while iterating.
 func (list *List) Iterator() treeset.Iterator {
 	return list.set.Iterator()
 }
@@ -82,6 +94,9 @@ func (list *List) ReadFile(filename string) error {
 
 // Write writes bookmarks to w as a newline separated list of comic numbers.
 func (list *List) Write(w io.Writer) error {
+	list.setMutex.RLock()
+	defer list.setMutex.RUnlock()
+
 	iter := list.set.Iterator()
 	for iter.Next() {
 		_, err := fmt.Fprintln(w, iter.Value().(int))
@@ -3,6 +3,7 @@ package bookmarks_test
 import (
 	"bytes"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/rkoesters/xkcd-gtk/internal/bookmarks"
@@ -54,6 +55,30 @@ func TestAddRemove(t *testing.T) {
 	}
 }
 
+// TestConcurrentContains checks that Contains can be called from other
+// goroutines while the bookmarks change. Run with -race.
+func TestConcurrentContains(t *testing.T) {
+	bookmarks := bookmarks.New()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 1000; n++ {
+			bookmarks.Contains(n)
+		}
+	}()
+	for n := 0; n < 1000; n++ {
+		bookmarks.Add(n)
+		bookmarks.Remove(n - 1)
+	}
+	wg.Wait()
+
+	if !bookmarks.Contains(999) {
+		t.Error("List does not contain last added value")
+	}
+}
+
 func TestReadWrite(t *testing.T) {
 	var buf bytes.Buffer
 	bookmarks := bookmarks.New()
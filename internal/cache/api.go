@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rkoesters/xkcd"
+)
+
+const defaultAPIBaseURL = "https://xkcd.com"
+
+var (
+	apiBaseURLFlag = flag.String("api-base-url", defaultAPIBaseURL, "Fetch comic metadata and images from the given origin instead of xkcd.com.")
+
+	// apiBaseURL is the parsed value of apiBaseURLFlag. Initialized in Init.
+	apiBaseURL *url.URL
+)
+
+// initAPIBaseURL parses and validates the -api-base-url flag.
+func initAPIBaseURL() error {
+	u, err := parseAPIBaseURL(*apiBaseURLFlag)
+	if err != nil {
+		return err
+	}
+	apiBaseURL = u
+	return nil
+}
+
+// parseAPIBaseURL parses s into an absolute URL suitable for use as the origin
+// of all comic metadata and image requests.
+func parseAPIBaseURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api base url %q: %w", s, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid api base url %q: scheme must be http or https", s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid api base url %q: missing host", s)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u, nil
+}
+
+// usingDefaultAPI returns true if requests go to the real xkcd servers.
+func usingDefaultAPI(base *url.URL) bool {
+	return base == nil || base.String() == defaultAPIBaseURL
+}
+
+// newestComicInfoURL returns the URL of the metadata for the newest comic.
+func newestComicInfoURL(base *url.URL) string {
+	return base.JoinPath("info.0.json").String()
+}
+
+// comicInfoURL returns the URL of the metadata for comic n.
+func comicInfoURL(base *url.URL, n int) string {
+	return base.JoinPath(strconv.Itoa(n), "info.0.json").String()
+}
+
+// comicImageURL returns the URL that should be used to download the image at
+// img. When using the default API, img is returned as-is, otherwise the image
+// is requested from base using the path of img (e.g. "/comics/foo.png").
+func comicImageURL(base *url.URL, img string) (string, error) {
+	if usingDefaultAPI(base) {
+		return img, nil
+	}
+	u, err := url.Parse(img)
+	if err != nil {
+		return "", err
+	}
+	return base.JoinPath(u.Path).String(), nil
+}
+
+// getComicInfo fetches and parses the comic metadata at the given URL. Returns
+// xkcd.ErrNotFound if the server does not have the comic, or a *statusError for
+// any other unsuccessful response.
+func getComicInfo(ctx context.Context, url string) (*xkcd.Comic, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRequest(req)
+	recordConnectivity(ctx, err)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = checkStatus(resp)
+	if err != nil {
+		return nil, err
+	}
+	return xkcd.New(resp.Body)
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestParseAPIBaseURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{in: "https://xkcd.com", want: "https://xkcd.com", ok: true},
+		{in: "http://localhost:8080/", want: "http://localhost:8080", ok: true},
+		{in: "https://mirror.example.com/xkcd/", want: "https://mirror.example.com/xkcd", ok: true},
+		{in: "ftp://xkcd.com", ok: false},
+		{in: "xkcd.com", ok: false},
+		{in: "https://", ok: false},
+	}
+	for _, test := range tests {
+		u, err := parseAPIBaseURL(test.in)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("parseAPIBaseURL(%q) succeeded, expected error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseAPIBaseURL(%q) returned error: %v", test.in, err)
+			continue
+		}
+		if u.String() != test.want {
+			t.Errorf("parseAPIBaseURL(%q) = %q, want %q", test.in, u, test.want)
+		}
+	}
+}
+
+func TestAPIURLs(t *testing.T) {
+	const img = "https://imgs.xkcd.com/comics/random_number.png"
+
+	def, err := parseAPIBaseURL(defaultAPIBaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror, err := parseAPIBaseURL("http://localhost:8080/xkcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		got, want string
+	}{
+		{newestComicInfoURL(def), "https://xkcd.com/info.0.json"},
+		{comicInfoURL(def, 221), "https://xkcd.com/221/info.0.json"},
+		{newestComicInfoURL(mirror), "http://localhost:8080/xkcd/info.0.json"},
+		{comicInfoURL(mirror, 221), "http://localhost:8080/xkcd/221/info.0.json"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("got %q, want %q", test.got, test.want)
+		}
+	}
+
+	got, err := comicImageURL(def, img)
+	if err != nil || got != img {
+		t.Errorf("comicImageURL(default) = %q, %v; want %q", got, err, img)
+	}
+	got, err = comicImageURL(mirror, img)
+	want := "http://localhost:8080/xkcd/comics/random_number.png"
+	if err != nil || got != want {
+		t.Errorf("comicImageURL(mirror) = %q, %v; want %q", got, err, want)
+	}
+}
@@ -0,0 +1,515 @@
+package cache
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rkoesters/xkcd"
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// A library archive is a zip file holding a copy of the comic cache so that it
+// can be moved to a machine without internet access. It contains:
+//
+//	manifest.json      an archiveManifest
+//	bookmarks.txt      the user's bookmarks, in the format of bookmarks.List
+//	metadata/<n>.json  the metadata of comic n
+//	images/<n>         the image of comic n
+//
+// Only the standard comic images are archived. Their high resolution variants
+// (see ImageVariant) are left out to keep archives small, so imported comics
+// are always shown from their standard image.
+const (
+	archiveManifestName  = "manifest.json"
+	archiveBookmarksName = "bookmarks.txt"
+	archiveMetadataDir   = "metadata"
+	archiveImageDir      = "images"
+)
+
+// archiveManifest describes the contents of a library archive.
+type archiveManifest struct {
+	CacheVersion int
+	CreatedAt    time.Time
+	Comics       int
+	Images       int
+}
+
+// ImportStat describes what ImportArchive added to the cache.
+type ImportStat struct {
+	Comics int
+	Images int
+}
+
+// ExportArchive writes the cached comic metadata and standard comic images,
+// along with the bookmarks read from bookmarks, to a library archive at
+// filename. Should not be called directly in the UI event loop.
+func ExportArchive(ctx context.Context, filename string, bookmarks io.Reader) error {
+	ctx, end, err := begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	log.Debugf("ExportArchive(%q) start", filename)
+	defer log.Debugf("ExportArchive(%q) end", filename)
+
+	metadata, err := cachedMetadata()
+	if err != nil {
+		return err
+	}
+	images, err := cachedImageNumbers()
+	if err != nil {
+		return err
+	}
+
+	// Write into a temporary file in the same directory so that a cancelled or
+	// failed export never leaves a truncated archive at filename.
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // Fails harmlessly once renamed.
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	err = writeArchiveJSON(zw, archiveManifestName, &archiveManifest{
+		CacheVersion: currentCacheVersion(),
+		CreatedAt:    time.Now(),
+		Comics:       len(metadata),
+		Images:       len(images),
+	})
+	if err != nil {
+		return err
+	}
+
+	w, err := zw.Create(archiveBookmarksName)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, bookmarks)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range slices.Sorted(maps.Keys(metadata)) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		w, err := zw.Create(archiveMetadataName(n))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(metadata[n])
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, n := range images {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = writeArchiveImage(zw, n)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// cachedMetadata returns a copy of the raw metadata of every cached comic.
+func cachedMetadata() (map[int][]byte, error) {
+	metadata := make(map[int][]byte)
+	err := cacheDB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheMetadataBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			n, err := bytesToInt(k)
+			if err != nil {
+				return err
+			}
+			// v is only valid for the life of the transaction.
+			metadata[n] = bytes.Clone(v)
+			return nil
+		})
+	})
+	return metadata, err
+}
+
+func writeArchiveJSON(zw *zip.Writer, name string, v any) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(v)
+}
+
+// writeArchiveImage copies comic n's cached image into zw.
+func writeArchiveImage(zw *zip.Writer, n int) error {
+	f, err := os.Open(ComicImagePath(n))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Comic images are already compressed, compressing them again would only
+	// waste time.
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     archiveImageName(n),
+		Method:   zip.Store,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func archiveMetadataName(n int) string {
+	return path.Join(archiveMetadataDir, strconv.Itoa(n)+".json")
+}
+
+func archiveImageName(n int) string {
+	return path.Join(archiveImageDir, strconv.Itoa(n))
+}
+
+// ImportArchive merges the library archive at filename into the cache. Comics
+// and images that are already cached are left alone, while new comics are added
+// to the search index. Invalid comics and images are skipped. The archive's
+// bookmarks are written to bookmarks so that they can be merged with the user's
+// bookmarks. Should not be called directly in the UI event loop.
+func ImportArchive(ctx context.Context, filename string, bookmarks io.Writer) (ImportStat, error) {
+	var stat ImportStat
+
+	ctx, end, err := begin(ctx)
+	if err != nil {
+		return stat, err
+	}
+	defer end()
+
+	log.Debugf("ImportArchive(%q) start", filename)
+	defer log.Debugf("ImportArchive(%q) end", filename)
+
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return stat, err
+	}
+	defer zr.Close()
+
+	manifest, err := readArchiveManifest(&zr.Reader)
+	if err != nil {
+		return stat, err
+	}
+	// Archives from older versions of the app are upgraded with the same
+	// migrations as the cache database.
+	steps, err := migrationPath(migrations, manifest.CacheVersion, currentCacheVersion())
+	if err != nil {
+		return stat, fmt.Errorf("%w: archive has cache version %v, expected %v: %v", ErrIncompatibleArchive, manifest.CacheVersion, currentCacheVersion(), err)
+	}
+
+	var metadata, images []*zip.File
+	for _, file := range zr.File {
+		dir, name := path.Split(file.Name)
+		switch {
+		case file.Name == archiveBookmarksName:
+			err = copyArchiveFile(bookmarks, file)
+			if err != nil {
+				return stat, err
+			}
+		case dir == archiveMetadataDir+"/" && strings.HasSuffix(name, ".json"):
+			metadata = append(metadata, file)
+		case dir == archiveImageDir+"/":
+			images = append(images, file)
+		}
+	}
+
+	// Import metadata before images, so that the cache never has an image
+	// for a comic without metadata.
+	stat.Comics, err = importArchiveMetadata(ctx, metadata, manifest.CacheVersion, steps)
+	if err != nil {
+		return stat, err
+	}
+
+	for _, file := range images {
+		if ctx.Err() != nil {
+			return stat, ctx.Err()
+		}
+
+		added, err := importArchiveImage(file)
+		if err != nil {
+			log.Printf("error importing %q: %v", file.Name, err)
+		} else if added {
+			stat.Images++
+		}
+	}
+
+	return stat, enforceImageQuota(0)
+}
+
+func readArchiveManifest(zr *zip.Reader) (*archiveManifest, error) {
+	f, err := zr.Open(archiveManifestName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIncompatibleArchive, err)
+	}
+	defer f.Close()
+
+	var manifest archiveManifest
+	err = json.NewDecoder(f).Decode(&manifest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad manifest: %v", ErrIncompatibleArchive, err)
+	}
+	return &manifest, nil
+}
+
+func copyArchiveFile(w io.Writer, file *zip.File) error {
+	r, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// importArchiveMetadata adds the comic metadata in files to the cache, unless
+// the comics are already cached. The metadata is first staged in a temporary
+// database in the format of cache version version, then upgraded to the
+// current format by steps. The added comics are written to the cache in a
+// single transaction and then to the search index in batches. Returns the
+// number of comics added.
+func importArchiveMetadata(ctx context.Context, files []*zip.File, version int, steps []migrationFunc) (int, error) {
+	staging, err := openStagingDB()
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(staging.Path())
+	defer staging.Close()
+
+	err = staging.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket(comicCacheMetadataBucketName)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			n, data, err := readArchiveMetadata(file)
+			if err != nil {
+				log.Printf("error importing %q: %v", file.Name, err)
+				continue
+			}
+			err = bucket.Put(intToBytes(n), data)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = runMigrations(staging, version, steps, false)
+	if err != nil {
+		return 0, err
+	}
+
+	var comics []*xkcd.Comic
+	err = staging.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheMetadataBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			comic, err := decodeArchiveComic(v)
+			if err != nil {
+				n, _ := bytesToInt(k)
+				log.Printf("error importing comic %v: %v", n, err)
+				return nil
+			}
+			comics = append(comics, comic)
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	added, err := putImportedComics(comics)
+	if err != nil {
+		return 0, err
+	}
+	for batch := range slices.Chunk(added, indexBatchSize) {
+		err = addToSearchIndex(batch...)
+		if err != nil {
+			return len(added), err
+		}
+	}
+	return len(added), nil
+}
+
+// openStagingDB creates and opens an empty database in a temporary file. The
+// caller must remove the file once done with it.
+func openStagingDB() (*bolt.DB, error) {
+	f, err := os.CreateTemp("", "xkcd-gtk-import-*.db")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return db, nil
+}
+
+// readArchiveMetadata returns the comic number and the contents of the
+// metadata file file.
+func readArchiveMetadata(file *zip.File) (int, []byte, error) {
+	name := strings.TrimSuffix(path.Base(file.Name), ".json")
+	n, err := strconv.Atoi(name)
+	if err != nil || n <= 0 {
+		return 0, nil, fmt.Errorf("invalid comic number %q", name)
+	}
+
+	r, err := file.Open()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	return n, data, err
+}
+
+// decodeArchiveComic decodes the comic metadata in data.
+func decodeArchiveComic(data []byte) (*xkcd.Comic, error) {
+	comic, err := xkcd.New(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if comic.Num <= 0 {
+		return nil, fmt.Errorf("invalid comic number %v", comic.Num)
+	}
+	return comic, nil
+}
+
+// putImportedComics adds comics to the cache database in a single transaction,
+// skipping the comics that are already cached. Returns the comics that were
+// added. No fetch time is recorded for them, so they are the first to be
+// revalidated (see staleComics).
+func putImportedComics(comics []*xkcd.Comic) ([]*xkcd.Comic, error) {
+	var added []*xkcd.Comic
+	err := cacheDB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheMetadataBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+		for _, comic := range comics {
+			if bucket.Get(intToBytes(comic.Num)) != nil {
+				continue
+			}
+			data, err := json.Marshal(comic)
+			if err != nil {
+				return err
+			}
+			err = bucket.Put(intToBytes(comic.Num), data)
+			if err != nil {
+				return err
+			}
+			err = putComicKind(tx, comic.Num, detectComicKind(comic))
+			if err != nil {
+				return err
+			}
+			added = append(added, comic)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// importArchiveImage adds the comic image in file to the image cache, unless
+// the image is already cached. Returns true if the image was added.
+func importArchiveImage(file *zip.File) (bool, error) {
+	n, err := strconv.Atoi(path.Base(file.Name))
+	if err != nil || n <= 0 {
+		return false, fmt.Errorf("invalid comic number %q", path.Base(file.Name))
+	}
+	if HasComicImage(n) {
+		return false, nil
+	}
+
+	r, err := file.Open()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	// Like fetchComicImage, only move the image into place once we know that
+	// it is valid.
+	f, err := os.CreateTemp(comicImageDirPath(), "*"+tempImageSuffix)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(f.Name()) // Fails harmlessly once renamed.
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return false, err
+	}
+	err = f.Close()
+	if err != nil {
+		return false, err
+	}
+
+	err = verifyImageFile(f.Name())
+	if err != nil {
+		return false, err
+	}
+	err = os.Rename(f.Name(), ComicImagePath(n))
+	if err != nil {
+		return false, err
+	}
+
+	info, err := imageInfoFromFile(ComicImagePath(n))
+	if err != nil {
+		return false, err
+	}
+	return true, putImageInfo(n, info)
+}
@@ -0,0 +1,258 @@
+package cache
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/rkoesters/xkcd"
+	bolt "go.etcd.io/bbolt"
+)
+
+// setupArchiveTest creates an empty cache in a temporary directory, replacing
+// any cache created by an earlier call. Returns the comics that are added to
+// the search index.
+func setupArchiveTest(t *testing.T) *[]int {
+	useTempCacheDir(t)
+	err := os.MkdirAll(comicImageDirPath(), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := useTempCacheDB(t, comicCacheMetadataBucketName)
+	initContext()
+
+	err = db.Update(migrateV2ToV3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = loadImageCacheSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { addImageCacheSize(-ImageCacheSize()) })
+
+	indexed := new([]int)
+	oldIndex := addToSearchIndex
+	addToSearchIndex = func(comics ...*xkcd.Comic) error {
+		for _, comic := range comics {
+			*indexed = append(*indexed, comic.Num)
+		}
+		return nil
+	}
+	t.Cleanup(func() { addToSearchIndex = oldIndex })
+	return indexed
+}
+
+// addTestComicImage adds a small valid image for comic n to the image cache.
+func addTestComicImage(t *testing.T, n int) {
+	f, err := os.Create(ComicImagePath(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	err = png.Encode(f, image.NewGray(image.Rect(0, 0, 4, 4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := imageInfoFromFile(ComicImagePath(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = putImageInfo(n, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestArchive writes a library archive with the given files to a
+// temporary file and returns its name.
+func writeTestArchive(t *testing.T, files map[string]string) string {
+	filename := filepath.Join(t.TempDir(), "library.zip")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write([]byte(contents))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// hasComicInfo returns true if comic n's metadata is in the cache.
+func hasComicInfo(n int) (bool, error) {
+	var cached bool
+	err := cacheDB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheMetadataBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+		cached = bucket.Get(intToBytes(n)) != nil
+		return nil
+	})
+	return cached, err
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	setupArchiveTest(t)
+	ctx := context.Background()
+
+	for _, n := range []int{1, 2, 1608} {
+		err := putComicInfo(&xkcd.Comic{Num: n, SafeTitle: "Comic", Img: "https://imgs.xkcd.com/comics/comic.png"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	addTestComicImage(t, 1)
+	addTestComicImage(t, 2)
+
+	filename := filepath.Join(t.TempDir(), "library.zip")
+	const bookmarks = "1\n1608\n"
+	err := ExportArchive(ctx, filename, bytes.NewBufferString(bookmarks))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := readArchiveManifest(&zr.Reader)
+	zr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.CacheVersion != currentCacheVersion() || manifest.Comics != 3 || manifest.Images != 2 || manifest.CreatedAt.IsZero() {
+		t.Errorf("manifest = %+v, want version %v with 3 comics and 2 images", manifest, currentCacheVersion())
+	}
+
+	// Import into an empty cache.
+	indexed := setupArchiveTest(t)
+	var imported bytes.Buffer
+	stat, err := ImportArchive(ctx, filename, &imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat != (ImportStat{Comics: 3, Images: 2}) {
+		t.Errorf("ImportArchive() = %+v, want 3 comics and 2 images", stat)
+	}
+	if imported.String() != bookmarks {
+		t.Errorf("imported bookmarks = %q, want %q", imported.String(), bookmarks)
+	}
+	slices.Sort(*indexed)
+	if !slices.Equal(*indexed, []int{1, 2, 1608}) {
+		t.Errorf("indexed = %v, want [1 2 1608]", *indexed)
+	}
+	for _, n := range []int{1, 2, 1608} {
+		cached, err := hasComicInfo(n)
+		if err != nil || !cached {
+			t.Errorf("hasComicInfo(%v) = %v, %v, want true", n, cached, err)
+		}
+		if got, want := HasComicImage(n), n != 1608; got != want {
+			t.Errorf("HasComicImage(%v) = %v, want %v", n, got, want)
+		}
+	}
+	if ComicKindOf(1608) != ComicKindInteractive {
+		t.Errorf("ComicKindOf(1608) = %v, want %v", ComicKindOf(1608), ComicKindInteractive)
+	}
+	// Imported comics are revalidated before any others.
+	_, err = ComicInfoFetchedAt(1)
+	if !errors.Is(err, ErrMiss) {
+		t.Errorf("ComicInfoFetchedAt(1) = %v, want %v", err, ErrMiss)
+	}
+
+	// Importing again adds nothing new.
+	stat, err = ImportArchive(ctx, filename, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat != (ImportStat{}) {
+		t.Errorf("second ImportArchive() = %+v, want nothing imported", stat)
+	}
+}
+
+func TestImportOlderArchive(t *testing.T) {
+	setupArchiveTest(t)
+
+	manifest, err := json.Marshal(&archiveManifest{CacheVersion: 2, Comics: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := writeTestArchive(t, map[string]string{
+		archiveManifestName:       string(manifest),
+		archiveMetadataName(1608): `{"num": 1608, "img": "https://imgs.xkcd.com/comics/hoverboard.png"}`,
+	})
+
+	stat, err := ImportArchive(context.Background(), filename, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Comics != 1 {
+		t.Errorf("ImportArchive() = %+v, want 1 comic", stat)
+	}
+	if ComicKindOf(1608) != ComicKindInteractive {
+		t.Errorf("ComicKindOf(1608) = %v, want %v", ComicKindOf(1608), ComicKindInteractive)
+	}
+}
+
+func TestImportBadArchive(t *testing.T) {
+	setupArchiveTest(t)
+
+	manifest := func(version int) string {
+		data, err := json.Marshal(&archiveManifest{CacheVersion: version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	tests := map[string]map[string]string{
+		"no manifest":       {archiveMetadataName(1): `{"num": 1}`},
+		"corrupt manifest":  {archiveManifestName: "{"},
+		"version too old":   {archiveManifestName: manifest(1)},
+		"version too new":   {archiveManifestName: manifest(currentCacheVersion() + 1)},
+		"version not given": {archiveManifestName: "{}"},
+	}
+	for name, files := range tests {
+		filename := writeTestArchive(t, files)
+		_, err := ImportArchive(context.Background(), filename, &bytes.Buffer{})
+		if !errors.Is(err, ErrIncompatibleArchive) {
+			t.Errorf("%v: ImportArchive() = %v, want %v", name, err, ErrIncompatibleArchive)
+		}
+	}
+
+	// Not a zip file at all.
+	filename := filepath.Join(t.TempDir(), "library.zip")
+	err := os.WriteFile(filename, []byte("not a zip file"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ImportArchive(context.Background(), filename, &bytes.Buffer{})
+	if err == nil {
+		t.Error("ImportArchive() of a corrupt archive succeeded")
+	}
+
+	cached, err := hasComicInfo(1)
+	if err != nil || cached {
+		t.Errorf("hasComicInfo(1) = %v, %v, want false", cached, err)
+	}
+}
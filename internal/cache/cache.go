@@ -3,9 +3,10 @@ package cache
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -21,15 +22,11 @@ import (
 	bolt "go.etcd.io/bbolt"
 )
 
-var (
-	offlineMode = flag.Bool("offline", false, "Do not use network, rely only on local data.")
-)
-
 const (
 	// cacheVersionCurrent should be incremented every time a release breaks
 	// compatibility with the previous release's cache (although breaking
 	// compatibility should be avoided).
-	cacheVersionCurrent = 2
+	cacheVersionCurrent = 3
 )
 
 var (
@@ -43,9 +40,12 @@ var (
 	recvCachedNewestComicUpdatedAt <-chan time.Time
 	sendCachedNewestComicUpdatedAt chan<- time.Time
 
-	// addToSearchIndex is a callback to insert the given comic into the search
-	// index.
-	addToSearchIndex func(comic *xkcd.Comic) error
+	// addToSearchIndex is a callback to insert the given comics into the
+	// search index.
+	addToSearchIndex func(comics ...*xkcd.Comic) error
+	// removeFromSearchIndex is a callback to delete the given comic from the
+	// search index.
+	removeFromSearchIndex func(n int) error
 
 	// Error messages to be shown in the window title. Initialized in Init to
 	// provide translations to system language.
@@ -55,12 +55,16 @@ var (
 	noComicsFound         string
 )
 
-// Init initializes the comic cache. Function index is called each time a comic
-// is inserted into the comic cache.
-func Init(index func(comic *xkcd.Comic) error) error {
+// Init initializes the comic cache. Function index is called with the comics
+// that are inserted into the comic cache. It is called concurrently while the
+// cache is filled, and with many comics at once when the search index is
+// rebuilt, so it should write the comics of concurrent calls together. Function
+// unindex is called with each comic that is deleted from the comic cache.
+func Init(index func(comics ...*xkcd.Comic) error, unindex func(n int) error) error {
 	checkForMisplacedCacheFiles()
 
 	addToSearchIndex = index
+	removeFromSearchIndex = unindex
 
 	// Initialize localized error strings.
 	cacheDatabaseError = l("Error reading local comic database")
@@ -68,17 +72,31 @@ func Init(index func(comic *xkcd.Comic) error) error {
 	couldNotDownloadComic = l("Couldn't get comic")
 	noComicsFound = l("Connect to the internet to download some comics!")
 
-	err := paths.EnsureCacheDir()
+	err := initAPIBaseURL()
+	if err != nil {
+		return err
+	}
+	err = initHTTPClient()
+	if err != nil {
+		return err
+	}
+
+	initContext()
+
+	err = paths.EnsureCacheDir()
 	if err != nil {
 		return err
 	}
 
 	// If the user's cache isn't compatible with our binary's cache
-	// implementation, then we need to start over (we will move the old cache to
-	// .bak just in case).
-	if existingCacheVersion() != currentCacheVersion() {
-		log.Debug("incompatible cache database found, backing up and rebuilding cache database...")
-		os.Rename(comicCacheDBPath(), comicCacheDBPath()+".bak")
+	// implementation, then we try to upgrade it. If that fails, we need to
+	// start over (we will move the old cache to .bak just in case).
+	if existing := existingCacheVersion(); existing != currentCacheVersion() {
+		err = migrateCache(existing, currentCacheVersion(), false)
+		if err != nil {
+			log.Print("error migrating cache, backing up and rebuilding cache database: ", err)
+			os.Rename(comicCacheDBPath(), comicCacheDBPath()+".bak")
+		}
 	}
 
 	// Open comic cache database.
@@ -100,6 +118,31 @@ func Init(index func(comic *xkcd.Comic) error) error {
 			return err
 		}
 
+		_, err = tx.CreateBucketIfNotExists(comicCacheFetchedAtBucketName)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists(newestComicCheckBucketName)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists(comicKindBucketName)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists(failedDownloadsMetadataBucketName)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists(failedDownloadsImageBucketName)
+		if err != nil {
+			return err
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -111,6 +154,25 @@ func Init(index func(comic *xkcd.Comic) error) error {
 	if err != nil {
 		return err
 	}
+	removeTempImages()
+
+	// Make sure the image cache directory and the image bucket agree on which
+	// images are in the cache.
+	err = reconcileImageStore()
+	if err != nil {
+		return err
+	}
+	err = loadImageCacheSize()
+	if err != nil {
+		return err
+	}
+
+	// Pick up where the last run left off, so restarting the app does not
+	// force a new check for the newest comic.
+	_, lastCheckedAt, err := loadNewestComicCheck()
+	if err != nil {
+		log.Print("error reading last newest comic check: ", err)
+	}
 
 	cachedNewestComicOut := make(chan *xkcd.Comic)
 	cachedNewestComicIn := make(chan *xkcd.Comic)
@@ -126,15 +188,14 @@ func Init(index func(comic *xkcd.Comic) error) error {
 	go func() {
 		var (
 			cachedNewestComic          *xkcd.Comic
-			cachedNewestComicUpdatedAt time.Time
+			cachedNewestComicUpdatedAt = lastCheckedAt
 		)
 
 		for {
 			select {
 			case newest := <-cachedNewestComicIn:
-				cachedNewestComicUpdatedAt = time.Now()
 				cachedNewestComic = newest
-				log.Debugf("newest cached comic set to %v at %v", newest.Num, cachedNewestComicUpdatedAt)
+				log.Debugf("newest cached comic set to %v", newest.Num)
 			case cachedNewestComicUpdatedAt = <-cachedNewestComicUpdatedAtIn:
 				log.Debugf("newest cached comic timestamp set to %v", cachedNewestComicUpdatedAt)
 			case cachedNewestComicOut <- cachedNewestComic:
@@ -148,45 +209,133 @@ func Init(index func(comic *xkcd.Comic) error) error {
 	return nil
 }
 
-// Close closes the comic cache.
+// Close cancels any in-flight cache operations and closes the comic cache.
 func Close() error {
+	Cancel()
+
 	err := cacheDB.Close()
 	if err != nil {
 		return err
 	}
 
-	f, err := os.Create(cacheVersionPath())
+	return writeCacheVersion(currentCacheVersion())
+}
+
+// DownloadAllComicMetadata asynchronously fills the comic metadata cache and
+// search index via the internet using a pool of concurrent workers (see the
+// -download-workers flag). Comic metadata and images that previously failed to
+// download are retried first. Progress is reported to progress observers as
+// OperationDownloadMetadata (see AddProgressObserver). Should not be called
+// directly in the UI event loop.
+func DownloadAllComicMetadata() {
+	err := DownloadAllComicMetadataContext(context.Background())
+	if err != nil {
+		log.Print("error downloading all comic metadata: ", err)
+	}
+}
+
+// DownloadAllComicMetadataContext is like DownloadAllComicMetadata, but stops
+// early and returns ctx.Err() if ctx is cancelled.
+func DownloadAllComicMetadataContext(ctx context.Context) (err error) {
+	ctx, end, err := begin(ctx)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	defer end()
+	ctx = withBulkRequests(ctx)
 
-	_, err = fmt.Fprintln(f, currentCacheVersion())
-	return err
+	newest, err := newestComicInfoFromInternet(ctx)
+	if err != nil {
+		return err
+	}
+	p := startProgress(OperationDownloadMetadata, newest.Num)
+	defer func() { p.finish(err) }()
+
+	retried, err := retryFailedMetadataDownloads(ctx)
+	if err != nil {
+		return err
+	}
+	err = forEachComic(ctx, newest.Num, parallelism(), func(n int) {
+		if err, ok := retried[n]; ok {
+			// Don't try again right after the retry failed.
+			p.result(n, 0, err)
+			return
+		}
+		_, err := comicInfo(ctx, n)
+		p.result(n, 0, err)
+	})
+	if err != nil {
+		return err
+	}
+
+	return retryFailedImageDownloads(ctx)
 }
 
-// DownloadAllComicMetadata asynchronously fills the comic metadata cache and
-// search index via the internet. Status can be checked with Stat(). Should not
-// be called directly in the UI event loop.
-func DownloadAllComicMetadata(cacheWindow ViewRefreshWitherGetter) {
-	newest, err := newestComicInfoFromInternet()
-	if err != nil {
-		log.Print(err)
-		return
-	}
-	for i := 1; i <= newest.Num; i++ {
-		ComicInfo(i)
-		cacheWindow().RefreshMetadataWith(Stat{
-			LatestComicNumber: newest.Num,
-			CachedCount:       i,
-		})
+// retryFailedMetadataDownloads retries downloading the comic metadata that is
+// on the failed downloads list. Returns the result of each retry.
+func retryFailedMetadataDownloads(ctx context.Context) (map[int]error, error) {
+	failed, err := failedDownloads(failedDownloadsMetadataBucketName)
+	if err != nil {
+		return nil, err
+	}
+	retried := make(map[int]error, len(failed))
+	for _, n := range failed {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Debugf("retrying failed download of comic metadata %v", n)
+		_, err = downloadComicInfo(ctx, n)
+		if err != nil {
+			log.Printf("error downloading comic metadata %v: %v", n, err)
+		}
+		retried[n] = err
+	}
+	return retried, nil
+}
+
+// retryFailedImageDownloads retries downloading the comic images that are on
+// the failed downloads list.
+func retryFailedImageDownloads(ctx context.Context) error {
+	failed, err := failedDownloads(failedDownloadsImageBucketName)
+	if err != nil {
+		return err
+	}
+	for _, n := range failed {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Debugf("retrying failed download of comic image %v", n)
+		_, err = downloadComicImage(ctx, n)
+		if err != nil {
+			log.Printf("error downloading comic image %v: %v", n, err)
+		}
 	}
+	return nil
 }
 
 // ComicInfo always returns a valid *xkcd.Comic that can be used, and err will
 // be set if any errors were encountered, however these errors can be ignored
 // safely.
 func ComicInfo(n int) (*xkcd.Comic, error) {
+	return ComicInfoContext(context.Background(), n)
+}
+
+// ComicInfoContext is like ComicInfo, but gives up on downloading the comic
+// metadata if ctx is cancelled.
+func ComicInfoContext(ctx context.Context, n int) (*xkcd.Comic, error) {
+	ctx, end, err := begin(ctx)
+	if err != nil {
+		return &xkcd.Comic{
+			Num:       n,
+			SafeTitle: couldNotDownloadComic,
+		}, err
+	}
+	defer end()
+
+	return comicInfo(ctx, n)
+}
+
+func comicInfo(ctx context.Context, n int) (*xkcd.Comic, error) {
 	var comic *xkcd.Comic
 
 	// Don't bother asking the server for comic 404, it will always return a
@@ -233,7 +382,7 @@ func ComicInfo(n int) (*xkcd.Comic, error) {
 		return nil
 	})
 	if err == ErrMiss {
-		comic, err = downloadComicInfo(n)
+		comic, err = downloadComicInfo(ctx, n)
 		if err == xkcd.ErrNotFound {
 			return &xkcd.Comic{
 				Num:       n,
@@ -255,13 +404,25 @@ func ComicInfo(n int) (*xkcd.Comic, error) {
 // returned error can be safely ignored. Should not be called directly in the UI
 // event loop.
 func CheckForNewestComicInfo(freshnessThreshold time.Duration) (*xkcd.Comic, error) {
+	return CheckForNewestComicInfoContext(context.Background(), freshnessThreshold)
+}
+
+// CheckForNewestComicInfoContext is like CheckForNewestComicInfo, but falls
+// back to the cache if ctx is cancelled before the xkcd API responds.
+func CheckForNewestComicInfoContext(ctx context.Context, freshnessThreshold time.Duration) (*xkcd.Comic, error) {
 	if time.Since(<-recvCachedNewestComicUpdatedAt) < freshnessThreshold {
 		return NewestComicInfoFromCache()
 	}
 
+	ctx, end, err := begin(ctx)
+	if err != nil {
+		return NewestComicInfoFromCache()
+	}
+	defer end()
+
 	sendCachedNewestComicUpdatedAt <- time.Now()
 
-	c, err := newestComicInfoFromInternet()
+	c, err := newestComicInfoFromInternet(ctx)
 	if err != nil {
 		return NewestComicInfoFromCache()
 	}
@@ -314,43 +475,87 @@ func NewestComicInfoFromCache() (*xkcd.Comic, error) {
 }
 
 // newestComicInfoFromInternet fetches the latest comic info from the internet.
-// May return nil, the returned error should be checked. Should not be called
-// directly in the UI event loop.
-func newestComicInfoFromInternet() (*xkcd.Comic, error) {
-	if *offlineMode {
+// The request is conditional on the validators from the last successful check,
+// so an unchanged newest comic is served from the cache. May return nil, the
+// returned error should be checked. Should not be called directly in the UI
+// event loop.
+func newestComicInfoFromInternet(ctx context.Context) (*xkcd.Comic, error) {
+	if Offline() {
 		return nil, ErrOffline
 	}
 
 	log.Debug("newestComicInfoFromInternet start")
 	defer log.Debug("newestComicInfoFromInternet end")
 
-	c, err := xkcd.GetCurrent()
+	v, _, err := loadNewestComicCheck()
 	if err != nil {
+		log.Print("error reading last newest comic check: ", err)
+	}
+	cached, err := NewestComicInfoFromCache()
+	if err != nil {
+		// There is nothing to fall back on if the server says the newest
+		// comic has not changed.
+		v = validators{}
+	}
+
+	c, v, err := getNewestComicInfo(ctx, newestComicInfoURL(apiBaseURL), v)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	} else if err == errNotModified {
+		log.Debugf("newest comic %v not modified", cached.Num)
+		checkedNewestComic(nil)
+		return cached, nil
+	} else if err != nil {
 		return nil, ErrOffline
 	}
 
 	sendCachedNewestComic <- c
+	checkedNewestComic(&v)
 	return c, putComicInfo(c)
 }
 
-func downloadComicInfo(n int) (*xkcd.Comic, error) {
-	if *offlineMode {
+// checkedNewestComic records that the xkcd API was just successfully checked
+// for the newest comic. If v is not nil, it replaces the stored validators.
+func checkedNewestComic(v *validators) {
+	now := time.Now()
+	sendCachedNewestComicUpdatedAt <- now
+	err := putNewestComicCheck(v, now)
+	if err != nil {
+		log.Print("error recording newest comic check: ", err)
+	}
+}
+
+func downloadComicInfo(ctx context.Context, n int) (*xkcd.Comic, error) {
+	if Offline() {
 		return nil, ErrOffline
 	}
 
 	log.Debugf("downloadComicInfo(%v) start", n)
 	defer log.Debugf("downloadComicInfo(%v) end", n)
 
-	comic, err := xkcd.Get(n)
+	var comic *xkcd.Comic
+	err := defaultRetryPolicy().do(ctx, fmt.Sprintf("downloadComicInfo(%v)", n), func() error {
+		var err error
+		comic, err = getComicInfo(ctx, comicInfoURL(apiBaseURL, n))
+		return err
+	})
+	if ctx.Err() == nil {
+		rerr := recordDownloadResult(failedDownloadsMetadataBucketName, n, err)
+		if rerr != nil {
+			log.Print("error updating failed downloads list: ", rerr)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 	return comic, putComicInfo(comic)
 }
 
-// putComicInfo adds the given xkcd.Comic to the cache database.
+// putComicInfo adds the given xkcd.Comic to the cache database and records that
+// it was just fetched, along with its ComicKind. Concurrent calls are coalesced
+// into a single database transaction.
 func putComicInfo(comic *xkcd.Comic) error {
-	err := cacheDB.Update(func(tx *bolt.Tx) error {
+	err := cacheDB.Batch(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket(comicCacheMetadataBucketName)
 		if bucket == nil {
 			return ErrLocalFailure
@@ -363,7 +568,15 @@ func putComicInfo(comic *xkcd.Comic) error {
 			return err
 		}
 
-		return bucket.Put(intToBytes(comic.Num), buf.Bytes())
+		err = bucket.Put(intToBytes(comic.Num), buf.Bytes())
+		if err != nil {
+			return err
+		}
+		err = putComicKind(tx, comic.Num, detectComicKind(comic))
+		if err != nil {
+			return err
+		}
+		return putFetchedAt(tx, comic.Num, time.Now())
 	})
 	if err != nil {
 		return err
@@ -374,59 +587,206 @@ func putComicInfo(comic *xkcd.Comic) error {
 
 // DownloadComicImage tries to add a comic image to our local cache. If
 // successful, the image can be found at the path returned by ComicImagePath.
-func DownloadComicImage(n int, cacheWindow ViewRefresherGetter) error {
-	if *offlineMode {
-		return ErrOffline
+// Progress is reported to progress observers as OperationDownloadImage (see
+// AddProgressObserver).
+func DownloadComicImage(n int) error {
+	return DownloadComicImageContext(context.Background(), n)
+}
+
+// DownloadComicImageContext is like DownloadComicImage, but aborts the download
+// if ctx is cancelled.
+func DownloadComicImageContext(ctx context.Context, n int) (err error) {
+	ctx, end, err := begin(ctx)
+	if err != nil {
+		return err
 	}
+	defer end()
+
+	p := startProgress(OperationDownloadImage, 1)
+	defer func() { p.finish(err) }()
+
+	bytes, err := downloadComicImage(ctx, n)
+	p.result(n, bytes, err)
+	return err
+}
 
-	defer func() { go cacheWindow().RefreshImages() }()
+// downloadComicImage downloads comic n's image into the cache. Returns the
+// number of bytes downloaded. Returns ErrNoComicImage if comic n does not have
+// an image that can be displayed (see ComicKindOf).
+func downloadComicImage(ctx context.Context, n int) (int64, error) {
+	if Offline() {
+		return 0, ErrOffline
+	}
 
 	log.Debugf("DownloadComicImage(%v) start", n)
 	defer log.Debugf("DownloadComicImage(%v) end", n)
 
-	comic, err := ComicInfo(n)
+	comic, err := comicInfo(ctx, n)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if kind := ComicKindOf(n); kind != ComicKindImage {
+		err = fmt.Errorf("%w: comic %v is %v", ErrNoComicImage, n, kind)
+		// The comic may have failed before it was known not to have an
+		// image, so there is nothing left to retry.
+		rerr := recordDownloadResult(failedDownloadsImageBucketName, n, err)
+		if rerr != nil {
+			log.Print("error updating failed downloads list: ", rerr)
+		}
+		return 0, err
 	}
 
-	resp, err := http.Get(comic.Img)
+	imgURL, err := comicImageURL(apiBaseURL, comic.Img)
 	if err != nil {
+		return 0, err
+	}
+
+	var info *ImageInfo
+	err = defaultRetryPolicy().do(ctx, fmt.Sprintf("DownloadComicImage(%v)", n), func() error {
+		var err error
+		info, err = fetchComicImage(ctx, imgURL, ComicImagePath(n))
 		return err
+	})
+	if ctx.Err() == nil {
+		rerr := recordDownloadResult(failedDownloadsImageBucketName, n, err)
+		if rerr != nil {
+			log.Print("error updating failed downloads list: ", rerr)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	if shouldDownloadImageVariants() {
+		downloadImageVariants(ctx, comic, info)
+	}
+	err = putImageInfo(n, info)
+	if err != nil {
+		return 0, err
+	}
+	return info.totalSize(), enforceImageQuota(n)
+}
+
+// fetchComicImage downloads the image at url and writes it to path. Returns an
+// ImageInfo describing the downloaded image.
+func fetchComicImage(ctx context.Context, url, path string) (*ImageInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRequest(req)
+	recordConnectivity(ctx, err)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	f, err := os.Create(ComicImagePath(n))
+	err = checkStatus(resp)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	err = checkImageContentType(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Download into a temporary file in the same directory so that an
+	// interrupted or invalid download never replaces the image at path.
+	f, err := os.CreateTemp(filepath.Dir(path), "*"+tempImageSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name()) // Fails harmlessly once renamed.
 	defer f.Close()
 
-	_, err = io.Copy(f, resp.Body)
+	size, err := io.Copy(f, resp.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyImageFile(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ImageInfo{
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        size,
+		Width:       imageWidth(path),
+		FetchedAt:   time.Now(),
+		ETag:        resp.Header.Get("ETag"),
+		SourceURL:   url,
+	}
+	if info.ContentType == "" {
+		info.ContentType, err = detectContentType(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
 }
 
 // DownloadAllComicImages tries to add all comic images to our local cache. If
 // successful, the images can be found at the path returned by ComicImagePath.
-func DownloadAllComicImages(cacheWindow ViewRefreshWitherGetter) {
+// Stops once the image cache reaches its quota (see SetImageQuota). Progress is
+// reported to progress observers as OperationDownloadImages (see
+// AddProgressObserver).
+func DownloadAllComicImages() {
+	err := DownloadAllComicImagesContext(context.Background())
+	if err != nil {
+		log.Print("error downloading all comic images: ", err)
+	}
+}
+
+// DownloadAllComicImagesContext is like DownloadAllComicImages, but stops early
+// and returns ctx.Err() if ctx is cancelled.
+func DownloadAllComicImagesContext(ctx context.Context) (err error) {
+	ctx, end, err := begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer end()
+	ctx = withBulkRequests(ctx)
+
 	newest, err := NewestComicInfoFromCache()
 	if err != nil {
-		log.Print(err)
-		return
+		return err
 	}
-	for i := 1; i <= newest.Num; i++ {
-		_, err = os.Stat(ComicImagePath(i))
-		if os.IsNotExist(err) {
-			DownloadComicImage(i, func() ViewRefresher { return nilRefresher })
+	// Downloading more images once the quota is reached would only evict the
+	// images that we just downloaded.
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	p := startProgress(OperationDownloadImages, newest.Num)
+	defer func() { p.finish(err) }()
+
+	err = forEachComic(ctx, newest.Num, parallelism(), func(n int) {
+		if HasComicImage(n) {
+			p.fetched(n, 0)
+			return
 		}
-
-		cacheWindow().RefreshImagesWith(Stat{
-			LatestComicNumber: newest.Num,
-			CachedCount:       i,
-		})
+		if imageQuotaReached() {
+			cancel(ErrImageQuotaReached)
+			return
+		}
+		bytes, err := downloadComicImage(ctx, n)
+		if errors.Is(err, ErrNoComicImage) {
+			// There is nothing more to download for this comic.
+			err = nil
+		}
+		p.result(n, bytes, err)
+	})
+	if err != nil {
+		return context.Cause(ctx)
 	}
+	return nil
 }
 
 // currentCacheVersion returns the cache version for this binary.
@@ -446,6 +806,18 @@ func existingCacheVersion() int {
 	return num
 }
 
+// writeCacheVersion records v as the version of the user's cache.
+func writeCacheVersion(v int) error {
+	f, err := os.Create(cacheVersionPath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, v)
+	return err
+}
+
 func intToBytes(i int) []byte {
 	buf := make([]byte, binary.MaxVarintLen64)
 
@@ -453,3 +825,8 @@ func intToBytes(i int) []byte {
 
 	return buf[:n]
 }
+
+func bytesToInt(b []byte) (int, error) {
+	i, err := binary.ReadVarint(bytes.NewReader(b))
+	return int(i), err
+}
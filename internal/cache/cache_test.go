@@ -2,11 +2,55 @@ package cache
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"math"
+	"path/filepath"
+	"sync"
 	"testing"
+
+	"github.com/rkoesters/xdg/basedir"
+	bolt "go.etcd.io/bbolt"
 )
 
+// useTempCacheDir makes the cache use a temporary directory instead of the
+// user's cache directory for the rest of the test. Setting XDG_CACHE_HOME is
+// not enough, basedir reads it when the program starts.
+func useTempCacheDir(t *testing.T) {
+	oldCacheHome := basedir.CacheHome
+	basedir.CacheHome = t.TempDir()
+	t.Cleanup(func() { basedir.CacheHome = oldCacheHome })
+}
+
+// useTempCacheDB makes the cache use an empty database in a temporary
+// directory, holding the given buckets, for the rest of the test. Returns the
+// database.
+func useTempCacheDB(t *testing.T, buckets ...[]byte) *bolt.DB {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "comics"), 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	oldDB := cacheDB
+	cacheDB = db
+	t.Cleanup(func() { cacheDB = oldDB })
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range buckets {
+			_, err := tx.CreateBucket(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
 func TestIntToBytes(t *testing.T) {
 	ints := []int{-1, 0, 1, math.MaxInt32, math.MaxUint32, math.MinInt32}
 
@@ -25,3 +69,51 @@ func TestIntToBytes(t *testing.T) {
 		}
 	}
 }
+
+func TestForEachComic(t *testing.T) {
+	const newest = 500
+
+	for _, workers := range []int{0, 1, 8} {
+		var (
+			mutex   sync.Mutex
+			visited = make(map[int]int)
+		)
+		err := forEachComic(context.Background(), newest, workers, func(n int) {
+			mutex.Lock()
+			visited[n]++
+			mutex.Unlock()
+		})
+		if err != nil {
+			t.Errorf("workers=%v: forEachComic returned error: %v", workers, err)
+		}
+
+		for n := 1; n <= newest; n++ {
+			if visited[n] != 1 {
+				t.Errorf("workers=%v: comic %v visited %v times", workers, n, visited[n])
+			}
+		}
+	}
+}
+
+func TestForEachComicCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var (
+		mutex   sync.Mutex
+		visited int
+	)
+	err := forEachComic(ctx, 1000, 4, func(n int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		visited++
+		if visited == 10 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("forEachComic returned %v, want %v", err, context.Canceled)
+	}
+	if visited >= 1000 {
+		t.Errorf("forEachComic visited all comics after being cancelled")
+	}
+}
@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/rkoesters/xkcd-gtk/internal/build"
+)
+
+var (
+	httpConnectTimeout = flag.Duration("http-connect-timeout", 15*time.Second, "Maximum time to wait for a connection to the xkcd server.")
+	httpReadTimeout    = flag.Duration("http-read-timeout", 30*time.Second, "Maximum time to wait for the xkcd server to send more data before giving up on a request.")
+	httpProxy          = flag.String("http-proxy", "", "Proxy URL to use for HTTP requests, or \"direct\" to not use a proxy. Defaults to the proxy set in the environment (e.g. HTTPS_PROXY).")
+	bulkRequestRate    = flag.Float64("bulk-request-rate", 10, "Maximum number of requests per second sent to the xkcd server while downloading many comics at once. Zero means unlimited.")
+)
+
+var (
+	// httpClient is used for every request to the xkcd server. Initialized in
+	// Init.
+	httpClient *http.Client
+	// userAgent is sent with every request to the xkcd server. Initialized in
+	// Init.
+	userAgent string
+	// bulkLimiter limits the rate of requests made with a context returned by
+	// withBulkRequests. Initialized in Init.
+	bulkLimiter *rateLimiter
+)
+
+// errStalled is returned when the xkcd server stops sending data for longer
+// than the -http-read-timeout flag.
+var errStalled = errors.New("server stopped responding")
+
+// initHTTPClient initializes httpClient, userAgent and bulkLimiter from the
+// command line flags.
+func initHTTPClient() error {
+	proxy, err := parseProxy(*httpProxy)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   *httpConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	httpClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 proxy,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   *httpConnectTimeout,
+			ResponseHeaderTimeout: *httpReadTimeout,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConnsPerHost:   parallelism(),
+			ForceAttemptHTTP2:     true,
+		},
+	}
+	userAgent = fmt.Sprintf("%v/%v (+https://github.com/rkoesters/xkcd-gtk; %v/%v)", build.AppID(), build.Version(), runtime.GOOS, runtime.GOARCH)
+	bulkLimiter = newRateLimiter(*bulkRequestRate)
+	return nil
+}
+
+// parseProxy returns the proxy function for the -http-proxy flag value s.
+func parseProxy(s string) (func(*http.Request) (*url.URL, error), error) {
+	switch s {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case "direct":
+		return nil, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", s, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: must include a scheme and host", s)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// doRequest sends req using httpClient. Requests made with a context returned
+// by withBulkRequests are rate limited. If the server stops sending the
+// response body for longer than the -http-read-timeout flag, reading the body
+// fails with errStalled.
+func doRequest(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if isBulkRequest(ctx) {
+		err := bulkLimiter.wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+
+	resp.Body = &stallTimeoutBody{
+		ReadCloser: resp.Body,
+		ctx:        ctx,
+		cancel:     cancel,
+		timeout:    *httpReadTimeout,
+		timer:      time.AfterFunc(*httpReadTimeout, func() { cancel(errStalled) }),
+	}
+	return resp, nil
+}
+
+// stallTimeoutBody cancels its request if no data is read for timeout.
+type stallTimeoutBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func (b *stallTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && context.Cause(b.ctx) == errStalled {
+		return n, errStalled
+	}
+	b.timer.Reset(b.timeout)
+	return n, err
+}
+
+func (b *stallTimeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
+
+type bulkRequestKey struct{}
+
+// withBulkRequests returns a context that marks requests made with it as part
+// of a bulk download, which are subject to the -bulk-request-rate flag.
+func withBulkRequests(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bulkRequestKey{}, true)
+}
+
+func isBulkRequest(ctx context.Context) bool {
+	bulk, _ := ctx.Value(bulkRequestKey{}).(bool)
+	return bulk
+}
+
+// rateLimiter spaces out events so that at most a given number happen per
+// second. A nil *rateLimiter does not limit anything.
+type rateLimiter struct {
+	interval time.Duration
+
+	mutex sync.Mutex
+	next  time.Time
+}
+
+// newRateLimiter returns a rateLimiter that allows perSecond events per second,
+// or nil if perSecond is not positive.
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+	}
+}
+
+// reserve returns how long the caller must wait before its event, given that
+// the time is now.
+func (rl *rateLimiter) reserve(now time.Time) time.Duration {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	d := rl.next.Sub(now)
+	rl.next = rl.next.Add(rl.interval)
+	return d
+}
+
+// wait blocks until the caller may proceed, or ctx is cancelled.
+func (rl *rateLimiter) wait(ctx context.Context) error {
+	if rl == nil {
+		return nil
+	}
+
+	d := rl.reserve(time.Now())
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
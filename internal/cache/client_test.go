@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseProxy(t *testing.T) {
+	tests := []struct {
+		s       string
+		wantNil bool
+		wantErr bool
+	}{
+		{"", false, false},
+		{"direct", true, false},
+		{"http://proxy.example.com:3128", false, false},
+		{"socks5://localhost:1080", false, false},
+		{"proxy.example.com", false, true},
+		{"http://", false, true},
+		{"://bad", false, true},
+	}
+	for _, test := range tests {
+		proxy, err := parseProxy(test.s)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseProxy(%q) error = %v, want error %v", test.s, err, test.wantErr)
+			continue
+		}
+		if err == nil && (proxy == nil) != test.wantNil {
+			t.Errorf("parseProxy(%q) nil = %v, want %v", test.s, proxy == nil, test.wantNil)
+		}
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	rl := newRateLimiter(4)
+	now := time.Now()
+
+	for i, want := range []time.Duration{0, 250 * time.Millisecond, 500 * time.Millisecond} {
+		got := rl.reserve(now)
+		if got != want {
+			t.Errorf("reserve %v: got %v, want %v", i, got, want)
+		}
+	}
+
+	// After an idle period, there is no backlog to wait for.
+	if got := rl.reserve(now.Add(time.Minute)); got != 0 {
+		t.Errorf("reserve after idle: got %v, want 0", got)
+	}
+
+	if newRateLimiter(0) != nil {
+		t.Error("newRateLimiter(0) should not limit")
+	}
+	if err := (*rateLimiter)(nil).wait(context.Background()); err != nil {
+		t.Errorf("nil rateLimiter wait: %v", err)
+	}
+}
+
+func TestDoRequestStalled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != userAgent {
+			t.Errorf("User-Agent = %q, want %q", r.Header.Get("User-Agent"), userAgent)
+		}
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	oldTimeout := *httpReadTimeout
+	*httpReadTimeout = 50 * time.Millisecond
+	defer func() { *httpReadTimeout = oldTimeout }()
+	err := initHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := doRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	_, err = io.ReadAll(resp.Body)
+	if !errors.Is(err, errStalled) {
+		t.Errorf("reading stalled body: got %v, want %v", err, errStalled)
+	}
+	if !isTransient(err) {
+		t.Errorf("stalled request should be transient")
+	}
+}
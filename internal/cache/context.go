@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	// closeCtx is cancelled by Cancel so that all in-flight cache operations
+	// stop before the cache database is closed. Initialized in Init.
+	closeCtx    context.Context
+	cancelClose context.CancelFunc
+
+	// operationMutex is held for reading by every in-flight cache operation
+	// and held for writing by Cancel while it waits for them to return.
+	operationMutex sync.RWMutex
+)
+
+// initContext initializes closeCtx.
+func initContext() {
+	closeCtx, cancelClose = context.WithCancel(context.Background())
+}
+
+// begin marks the start of an exported cache operation. The returned context is
+// cancelled when either parent is cancelled or Cancel is called. The returned
+// end function must be called once the operation returns. If Cancel has already
+// been called, begin returns an error and the operation must not continue.
+//
+// Operations must not call begin while already inside another operation.
+func begin(parent context.Context) (ctx context.Context, end func(), err error) {
+	operationMutex.RLock()
+	if closeCtx == nil {
+		operationMutex.RUnlock()
+		return nil, nil, ErrLocalFailure
+	}
+	if err := closeCtx.Err(); err != nil {
+		operationMutex.RUnlock()
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	stop := context.AfterFunc(closeCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+		operationMutex.RUnlock()
+	}, nil
+}
+
+// Cancel cancels all in-flight cache operations and waits for them to return.
+// Any cache operation started after calling Cancel fails immediately. Cancel
+// should be called before closing the search index and calling Close.
+func Cancel() {
+	if cancelClose == nil {
+		return
+	}
+	cancelClose()
+
+	operationMutex.Lock()
+	defer operationMutex.Unlock()
+}
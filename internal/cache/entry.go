@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rkoesters/xkcd"
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ComicEntry describes what the cache holds for a comic.
+type ComicEntry struct {
+	Num       int
+	SafeTitle string
+	// FetchedAt is when the comic metadata was last fetched, or the zero
+	// time if unknown.
+	FetchedAt time.Time
+	HasImage  bool
+	// ImageSize is the disk space used by the comic image, including any
+	// HiDPI variants.
+	ImageSize int64
+}
+
+// ComicEntries returns an entry for every comic in the cache, sorted by comic
+// number. Comics with an image but no metadata are included too.
+func ComicEntries() ([]ComicEntry, error) {
+	entries := make(map[int]*ComicEntry)
+	entry := func(n int) *ComicEntry {
+		e, ok := entries[n]
+		if !ok {
+			e = &ComicEntry{Num: n}
+			entries[n] = e
+		}
+		return e
+	}
+
+	err := cacheDB.View(func(tx *bolt.Tx) error {
+		metadata := tx.Bucket(comicCacheMetadataBucketName)
+		fetched := tx.Bucket(comicCacheFetchedAtBucketName)
+		images := tx.Bucket(comicCacheImageBucketName)
+		if metadata == nil || fetched == nil || images == nil {
+			return ErrLocalFailure
+		}
+
+		err := metadata.ForEach(func(k, v []byte) error {
+			n, err := bytesToInt(k)
+			if err != nil {
+				return err
+			}
+			comic, err := xkcd.New(bytes.NewReader(v))
+			if err != nil {
+				log.Printf("error decoding cached comic %v: %v", n, err)
+				comic = &xkcd.Comic{}
+			}
+			e := entry(n)
+			e.SafeTitle = comic.SafeTitle
+			if data := fetched.Get(k); data != nil {
+				return e.FetchedAt.UnmarshalBinary(data)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return images.ForEach(func(k, v []byte) error {
+			n, err := bytesToInt(k)
+			if err != nil {
+				return err
+			}
+			var info ImageInfo
+			err = json.Unmarshal(v, &info)
+			if err != nil {
+				log.Printf("error decoding cached image info %v: %v", n, err)
+			}
+			e := entry(n)
+			e.HasImage = true
+			e.ImageSize = info.totalSize()
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]ComicEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Num < list[j].Num
+	})
+	return list, nil
+}
+
+// DeleteComic removes comic n from the cache and the search index. The comic is
+// downloaded again the next time it is viewed or the cache is filled.
+func DeleteComic(n int) error {
+	_, end, err := begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	log.Debugf("deleting comic %v from the cache", n)
+
+	err = removeComicImage(n)
+	if err != nil {
+		return err
+	}
+
+	err = cacheDB.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			comicCacheMetadataBucketName,
+			comicCacheFetchedAtBucketName,
+			comicKindBucketName,
+			failedDownloadsMetadataBucketName,
+			failedDownloadsImageBucketName,
+		} {
+			bucket := tx.Bucket(name)
+			if bucket == nil {
+				return ErrLocalFailure
+			}
+			err := bucket.Delete(intToBytes(n))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return removeFromSearchIndex(n)
+}
+
+// RefreshComic downloads comic n's metadata and image again, replacing the
+// cached copies, then notifies comic observers (see AddComicObserver). Only the
+// metadata of comics without an image (see ComicKind) is downloaded. Should not
+// be called directly in the UI event loop.
+func RefreshComic(ctx context.Context, n int) error {
+	ctx, end, err := begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	if Offline() {
+		return ErrOffline
+	}
+
+	log.Debugf("refreshing comic %v", n)
+
+	_, err = downloadComicInfo(ctx, n)
+	if err != nil {
+		return fmt.Errorf("downloading metadata: %w", err)
+	}
+	_, err = downloadComicImage(ctx, n)
+	if err != nil && !errors.Is(err, ErrNoComicImage) {
+		return fmt.Errorf("downloading image: %w", err)
+	}
+	notifyComicObservers(n)
+	return nil
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestComicEntriesAndDeleteComic(t *testing.T) {
+	useTempCacheDir(t)
+	db := useTempCacheDB(t,
+		comicCacheMetadataBucketName,
+		comicCacheFetchedAtBucketName,
+		comicCacheImageBucketName,
+		comicKindBucketName,
+		failedDownloadsMetadataBucketName,
+		failedDownloadsImageBucketName,
+	)
+	initContext()
+	var unindexed []int
+	oldUnindex := removeFromSearchIndex
+	removeFromSearchIndex = func(n int) error {
+		unindexed = append(unindexed, n)
+		return nil
+	}
+	defer func() { removeFromSearchIndex = oldUnindex }()
+
+	fetchedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := db.Update(func(tx *bolt.Tx) error {
+		metadata := tx.Bucket(comicCacheMetadataBucketName)
+		err := metadata.Put(intToBytes(1), []byte(`{"num": 1, "safe_title": "One"}`))
+		if err != nil {
+			return err
+		}
+		err = metadata.Put(intToBytes(2), []byte(`{"num": 2, "safe_title": "Two"}`))
+		if err != nil {
+			return err
+		}
+		err = putFetchedAt(tx, 2, fetchedAt)
+		if err != nil {
+			return err
+		}
+		images := tx.Bucket(comicCacheImageBucketName)
+		err = images.Put(intToBytes(2), []byte(`{"Size": 100, "Variants": {"1": {"Size": 50}}}`))
+		if err != nil {
+			return err
+		}
+		// An image without metadata.
+		return images.Put(intToBytes(3), []byte(`{"Size": 10}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ComicEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ComicEntry{
+		{Num: 1, SafeTitle: "One"},
+		{Num: 2, SafeTitle: "Two", FetchedAt: fetchedAt, HasImage: true, ImageSize: 150},
+		{Num: 3, HasImage: true, ImageSize: 10},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %v entries, want %v: %+v", len(entries), len(want), entries)
+	}
+	for i := range want {
+		if entries[i].Num != want[i].Num ||
+			entries[i].SafeTitle != want[i].SafeTitle ||
+			!entries[i].FetchedAt.Equal(want[i].FetchedAt) ||
+			entries[i].HasImage != want[i].HasImage ||
+			entries[i].ImageSize != want[i].ImageSize {
+			t.Errorf("entry %v = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+
+	err = DeleteComic(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = ComicEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Num != 1 || entries[1].Num != 3 {
+		t.Errorf("entries after deleting comic 2 = %+v, want comics 1 and 3", entries)
+	}
+	if !slices.Equal(unindexed, []int{2}) {
+		t.Errorf("comics removed from the search index = %v, want [2]", unindexed)
+	}
+}
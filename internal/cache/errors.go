@@ -15,4 +15,14 @@ var (
 	ErrOffline = errors.New("error accessing xkcd server")
 	// ErrNoComicsFound is returned when a function can not find any comics.
 	ErrNoComicsFound = errors.New("no comics found")
+	// ErrInvalidImage means that a comic image is not a valid image file.
+	ErrInvalidImage = errors.New("invalid comic image")
+	// ErrNoComicImage means that a comic does not have an image that can be
+	// displayed, for example because it is interactive.
+	ErrNoComicImage = errors.New("comic has no image")
+	// ErrImageQuotaReached means that the image cache is full.
+	ErrImageQuotaReached = errors.New("image cache quota reached")
+	// ErrIncompatibleArchive means that a library archive can not be imported
+	// into this version of the cache.
+	ErrIncompatibleArchive = errors.New("incompatible library archive")
 )
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// failedDownloadsMetadataBucketName and failedDownloadsImageBucketName
+	// hold the comics whose metadata or image could not be downloaded due to a
+	// transient error. They are retried by the next DownloadAllComicMetadata.
+	failedDownloadsMetadataBucketName = []byte("failed_comic_metadata")
+	failedDownloadsImageBucketName    = []byte("failed_comic_image")
+)
+
+// failedDownload records why and when a comic download last failed.
+type failedDownload struct {
+	Error    string
+	Attempts int
+	FailedAt time.Time
+}
+
+// recordDownloadResult updates the failed downloads list in the given bucket
+// for comic n based on err. Transient errors add the comic to the list, while
+// success or a permanent error removes it.
+func recordDownloadResult(bucketName []byte, n int, err error) error {
+	return cacheDB.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+
+		key := intToBytes(n)
+		if !isTransient(err) {
+			return bucket.Delete(key)
+		}
+
+		var fd failedDownload
+		if data := bucket.Get(key); data != nil {
+			// Ignore decoding errors, the old record will be replaced anyway.
+			json.Unmarshal(data, &fd)
+		}
+		fd.Error = err.Error()
+		fd.Attempts++
+		fd.FailedAt = time.Now()
+
+		var buf bytes.Buffer
+		e := json.NewEncoder(&buf)
+		err := e.Encode(&fd)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, buf.Bytes())
+	})
+}
+
+// failedDownloads returns the comic numbers in the given failed downloads
+// bucket.
+func failedDownloads(bucketName []byte) ([]int, error) {
+	var comics []int
+	err := cacheDB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+
+		return bucket.ForEach(func(k, _ []byte) error {
+			n, err := bytesToInt(k)
+			if err != nil {
+				return err
+			}
+			comics = append(comics, n)
+			return nil
+		})
+	})
+	return comics, err
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/rkoesters/xkcd"
+	bolt "go.etcd.io/bbolt"
+)
+
+// setupFailedDownloadsTest opens a temporary cache database with the buckets
+// used to download comic metadata.
+func setupFailedDownloadsTest(t *testing.T) {
+	useTempCacheDB(t,
+		comicCacheMetadataBucketName,
+		comicCacheFetchedAtBucketName,
+		comicKindBucketName,
+		failedDownloadsMetadataBucketName,
+	)
+}
+
+func TestRecordDownloadResult(t *testing.T) {
+	setupFailedDownloadsTest(t)
+
+	transient := &statusError{url: "https://xkcd.com/1/info.0.json", code: http.StatusServiceUnavailable}
+	record := func(n int, err error) {
+		t.Helper()
+		rerr := recordDownloadResult(failedDownloadsMetadataBucketName, n, err)
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+	}
+	check := func(want []int) {
+		t.Helper()
+		got, err := failedDownloads(failedDownloadsMetadataBucketName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("failedDownloads() = %v, want %v", got, want)
+		}
+	}
+
+	check(nil)
+
+	record(1, transient)
+	record(2, transient)
+	record(2, transient)
+	record(3, xkcd.ErrNotFound)
+	check([]int{1, 2})
+
+	err := cacheDB.View(func(tx *bolt.Tx) error {
+		var fd failedDownload
+		data := tx.Bucket(failedDownloadsMetadataBucketName).Get(intToBytes(2))
+		err := json.Unmarshal(data, &fd)
+		if err != nil {
+			return err
+		}
+		if fd.Attempts != 2 || fd.Error != transient.Error() || fd.FailedAt.IsZero() {
+			t.Errorf("failed download of comic 2 = %+v, want 2 attempts of %q", fd, transient)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Success and permanent errors take comics off the list.
+	record(1, nil)
+	record(2, xkcd.ErrNotFound)
+	check(nil)
+}
+
+func TestRetryFailedMetadataDownloads(t *testing.T) {
+	setupFailedDownloadsTest(t)
+	var indexed []int
+	oldIndex := addToSearchIndex
+	addToSearchIndex = func(comics ...*xkcd.Comic) error {
+		for _, comic := range comics {
+			indexed = append(indexed, comic.Num)
+		}
+		return nil
+	}
+	t.Cleanup(func() { addToSearchIndex = oldIndex })
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1/info.0.json":
+			w.Write([]byte(`{"num": 1, "safe_title": "One"}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	err := initHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldBaseURL := apiBaseURL
+	apiBaseURL, err = url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { apiBaseURL = oldBaseURL }()
+	oldRetries := *downloadRetries
+	*downloadRetries = 0
+	defer func() { *downloadRetries = oldRetries }()
+
+	transient := &statusError{url: srv.URL, code: http.StatusServiceUnavailable}
+	for _, n := range []int{1, 2} {
+		err = recordDownloadResult(failedDownloadsMetadataBucketName, n, transient)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	retried, err := retryFailedMetadataDownloads(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retried) != 2 || retried[1] != nil {
+		t.Errorf("retried = %v, want comic 1 to succeed", retried)
+	}
+	var se *statusError
+	if !errors.As(retried[2], &se) {
+		t.Errorf("retry of comic 2 = %v, want a *statusError", retried[2])
+	}
+	if !slices.Equal(indexed, []int{1}) {
+		t.Errorf("indexed = %v, want [1]", indexed)
+	}
+
+	failed, err := failedDownloads(failedDownloadsMetadataBucketName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(failed, []int{2}) {
+		t.Errorf("failedDownloads() = %v, want [2]", failed)
+	}
+}
@@ -0,0 +1,287 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ImageInfo describes a comic image in the image cache. The image itself is
+// stored at ComicImagePath, while its ImageInfo is stored in the
+// comicCacheImageBucketName bucket using the comic number as the key. A comic
+// image is only considered cached if it has an ImageInfo.
+type ImageInfo struct {
+	ContentType string
+	Size        int64
+	Width       int
+	FetchedAt   time.Time
+	ViewedAt    time.Time
+	ETag        string
+	SourceURL   string
+
+	// Variants holds the high resolution variants of the image that are in
+	// the cache. The variants are stored at ComicImageVariantPath.
+	Variants map[ImageVariant]VariantInfo `json:",omitempty"`
+}
+
+// ComicImageInfo returns the ImageInfo for comic n's image. Returns ErrMiss if
+// the image is not in the cache.
+func ComicImageInfo(n int) (*ImageInfo, error) {
+	var info *ImageInfo
+	err := cacheDB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheImageBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+
+		data := bucket.Get(intToBytes(n))
+		if data == nil {
+			return ErrMiss
+		}
+
+		info = &ImageInfo{}
+		return json.Unmarshal(data, info)
+	})
+	return info, err
+}
+
+// HasComicImage returns true if comic n's image is in the cache.
+func HasComicImage(n int) bool {
+	_, err := ComicImageInfo(n)
+	return err == nil
+}
+
+// putImageInfo records info as the ImageInfo for comic n's image.
+func putImageInfo(n int, info *ImageInfo) error {
+	var oldSize int64
+	err := cacheDB.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheImageBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+
+		oldSize = storedImageSize(bucket, n)
+
+		var buf bytes.Buffer
+		e := json.NewEncoder(&buf)
+		err := e.Encode(info)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(intToBytes(n), buf.Bytes())
+	})
+	if err != nil {
+		return err
+	}
+	addImageCacheSize(info.totalSize() - oldSize)
+	return nil
+}
+
+// storedImageSize returns the total size of comic n's image according to its
+// ImageInfo in bucket, or 0 if it has none.
+func storedImageSize(bucket *bolt.Bucket, n int) int64 {
+	data := bucket.Get(intToBytes(n))
+	if data == nil {
+		return 0
+	}
+	var info ImageInfo
+	err := json.Unmarshal(data, &info)
+	if err != nil {
+		return 0
+	}
+	return info.totalSize()
+}
+
+// removeComicImage removes comic n's image, its variants, and its ImageInfo
+// from the cache.
+func removeComicImage(n int) error {
+	var oldSize int64
+	err := cacheDB.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheImageBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+		oldSize = storedImageSize(bucket, n)
+		return bucket.Delete(intToBytes(n))
+	})
+	if err != nil {
+		return err
+	}
+	addImageCacheSize(-oldSize)
+
+	for _, v := range hiDPIImageVariants {
+		err = os.Remove(ComicImageVariantPath(n, v))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	err = os.Remove(ComicImagePath(n))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// forEachImageInfo calls fn for every image in the image cache.
+func forEachImageInfo(fn func(n int, info *ImageInfo) error) error {
+	return cacheDB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheImageBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			n, err := bytesToInt(k)
+			if err != nil {
+				return err
+			}
+			var info ImageInfo
+			err = json.Unmarshal(v, &info)
+			if err != nil {
+				return err
+			}
+			return fn(n, &info)
+		})
+	})
+}
+
+// cachedImageNumbers returns the numbers of the comics whose images are in the
+// image cache.
+func cachedImageNumbers() ([]int, error) {
+	var comics []int
+	err := forEachImageInfo(func(n int, _ *ImageInfo) error {
+		comics = append(comics, n)
+		return nil
+	})
+	return comics, err
+}
+
+// reconcileImageStore makes the image cache directory and the
+// comicCacheImageBucketName bucket agree with each other. Images without an
+// ImageInfo (e.g. from a version of the app that did not record them) are
+// given one based on the file, and ImageInfos without an image are removed.
+func reconcileImageStore() error {
+	files, err := os.ReadDir(comicImageDirPath())
+	if err != nil {
+		return err
+	}
+
+	onDisk := make(map[int]bool)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		n, err := strconv.Atoi(file.Name())
+		if err != nil || n <= 0 {
+			continue
+		}
+		onDisk[n] = true
+	}
+
+	return cacheDB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheImageBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+
+		var stale []int
+		err := bucket.ForEach(func(k, _ []byte) error {
+			n, err := bytesToInt(k)
+			if err != nil {
+				return err
+			}
+			if onDisk[n] {
+				delete(onDisk, n)
+			} else {
+				stale = append(stale, n)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, n := range stale {
+			log.Debugf("removing image info without an image: %v", n)
+			err = bucket.Delete(intToBytes(n))
+			if err != nil {
+				return err
+			}
+		}
+
+		for n := range onDisk {
+			log.Debugf("adding image info for untracked image %v", n)
+			info, err := imageInfoFromFile(ComicImagePath(n))
+			if err != nil {
+				log.Printf("error reading cached comic image %v: %v", n, err)
+				continue
+			}
+			data, err := json.Marshal(info)
+			if err != nil {
+				return err
+			}
+			err = bucket.Put(intToBytes(n), data)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// imageInfoFromFile creates an ImageInfo by inspecting the image at path. The
+// ETag and SourceURL of such images are unknown.
+func imageInfoFromFile(path string) (*ImageInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	ct, err := readContentType(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImageInfo{
+		ContentType: ct,
+		Size:        fi.Size(),
+		Width:       imageWidth(path),
+		FetchedAt:   fi.ModTime(),
+	}, nil
+}
+
+// detectContentType guesses the content type of the file at path.
+func detectContentType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return readContentType(f)
+}
+
+// readContentType guesses the content type of the data in r.
+func readContentType(r io.Reader) (string, error) {
+	// http.DetectContentType considers at most 512 bytes.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"bytes"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/rkoesters/xkcd"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ComicKind describes how a comic can be displayed.
+type ComicKind byte
+
+const (
+	// ComicKindImage is a comic with a regular image.
+	ComicKindImage ComicKind = iota
+	// ComicKindInteractive is an interactive or animated comic that only
+	// works in a web browser. Its image, if any, is just a placeholder.
+	ComicKindInteractive
+	// ComicKindNoImage is a comic whose metadata does not point to an image.
+	ComicKindNoImage
+)
+
+func (k ComicKind) String() string {
+	switch k {
+	case ComicKindImage:
+		return "image"
+	case ComicKindInteractive:
+		return "interactive"
+	case ComicKindNoImage:
+		return "no image"
+	default:
+		return "unknown"
+	}
+}
+
+// comicKindBucketName is the bucket that records the ComicKind of each comic in
+// the metadata cache.
+var comicKindBucketName = []byte("comic_kind")
+
+// knownInteractiveComics are comics that only work in a web browser even though
+// their metadata points to an image.
+var knownInteractiveComics = map[int]bool{
+	1110: true, // Click and Drag
+	1190: true, // Time
+	1193: true, // Externalities
+	1416: true, // Pixels
+	1506: true, // xkcloud
+	1525: true, // Emojic 8 Ball
+	1608: true, // Hoverboard
+	1663: true, // Garden
+	1975: true, // Right Click
+	2067: true, // Challengers
+	2131: true, // Emojidome
+	2198: true, // Throw
+}
+
+// imageExtensions are the file extensions of the images that the comic image
+// viewer can display.
+var imageExtensions = map[string]bool{
+	".gif":  true,
+	".jpeg": true,
+	".jpg":  true,
+	".png":  true,
+}
+
+// detectComicKind guesses the kind of comic from its metadata.
+func detectComicKind(comic *xkcd.Comic) ComicKind {
+	if knownInteractiveComics[comic.Num] {
+		return ComicKindInteractive
+	}
+	if comic.Img == "" {
+		return ComicKindNoImage
+	}
+	u, err := url.Parse(comic.Img)
+	if err != nil {
+		return ComicKindNoImage
+	}
+	if !imageExtensions[strings.ToLower(path.Ext(u.Path))] {
+		// Some comics point to a directory or a web page instead of an
+		// image.
+		return ComicKindInteractive
+	}
+	return ComicKindImage
+}
+
+// putComicKind records the kind of comic n.
+func putComicKind(tx *bolt.Tx, n int, kind ComicKind) error {
+	bucket := tx.Bucket(comicKindBucketName)
+	if bucket == nil {
+		return ErrLocalFailure
+	}
+	return bucket.Put(intToBytes(n), []byte{byte(kind)})
+}
+
+// ComicKindOf returns the kind of comic n. Returns ComicKindImage if comic n is
+// not in the cache.
+func ComicKindOf(n int) ComicKind {
+	kind := ComicKindImage
+	cacheDB.View(func(tx *bolt.Tx) error {
+		kinds := tx.Bucket(comicKindBucketName)
+		if kinds == nil {
+			return ErrLocalFailure
+		}
+		if data := kinds.Get(intToBytes(n)); len(data) == 1 {
+			kind = ComicKind(data[0])
+			return nil
+		}
+
+		// The comic may have been cached by an older version of the app,
+		// before comic kinds were recorded.
+		metadata := tx.Bucket(comicCacheMetadataBucketName)
+		if metadata == nil {
+			return ErrLocalFailure
+		}
+		data := metadata.Get(intToBytes(n))
+		if data == nil {
+			return ErrMiss
+		}
+		comic, err := xkcd.New(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		kind = detectComicKind(comic)
+		return nil
+	})
+	return kind
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rkoesters/xkcd"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDetectComicKind(t *testing.T) {
+	tests := []struct {
+		comic xkcd.Comic
+		want  ComicKind
+	}{
+		{xkcd.Comic{Num: 353, Img: "https://imgs.xkcd.com/comics/python.png"}, ComicKindImage},
+		{xkcd.Comic{Num: 1, Img: "https://imgs.xkcd.com/comics/barrel_cropped_(1).jpg"}, ComicKindImage},
+		{xkcd.Comic{Num: 961, Img: "https://imgs.xkcd.com/comics/eternal_flame.GIF"}, ComicKindImage},
+		{xkcd.Comic{Num: 1190, Img: "https://imgs.xkcd.com/comics/time.png"}, ComicKindInteractive},
+		{xkcd.Comic{Num: 1608, Img: "https://imgs.xkcd.com/comics/hoverboard.png"}, ComicKindInteractive},
+		{xkcd.Comic{Num: 9999, Img: "https://imgs.xkcd.com/comics/"}, ComicKindInteractive},
+		{xkcd.Comic{Num: 9999, Img: "https://xkcd.com/9999/index.html"}, ComicKindInteractive},
+		{xkcd.Comic{Num: 9999}, ComicKindNoImage},
+	}
+	for _, test := range tests {
+		got := detectComicKind(&test.comic)
+		if got != test.want {
+			t.Errorf("detectComicKind(%v, %q) = %v, want %v", test.comic.Num, test.comic.Img, got, test.want)
+		}
+	}
+}
+
+func TestDownloadComicImageWithoutImage(t *testing.T) {
+	db := useTempCacheDB(t,
+		comicCacheMetadataBucketName,
+		comicKindBucketName,
+		failedDownloadsImageBucketName,
+	)
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		metadata := tx.Bucket(comicCacheMetadataBucketName)
+		err := metadata.Put(intToBytes(1608), []byte(`{"num": 1608, "img": "https://imgs.xkcd.com/comics/hoverboard.png"}`))
+		if err != nil {
+			return err
+		}
+		// The image failed to download before the comic was known to be
+		// interactive.
+		failed := tx.Bucket(failedDownloadsImageBucketName)
+		return failed.Put(intToBytes(1608), []byte(`{"Attempts": 1}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = downloadComicImage(context.Background(), 1608)
+	if !errors.Is(err, ErrNoComicImage) {
+		t.Errorf("downloadComicImage(1608) = %v, want %v", err, ErrNoComicImage)
+	}
+	failed, err := failedDownloads(failedDownloadsImageBucketName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 0 {
+		t.Errorf("failed image downloads = %v, want none", failed)
+	}
+}
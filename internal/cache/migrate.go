@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rkoesters/xkcd"
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// migrationFunc upgrades the cache database by one version. It may only modify
+// the cache through tx, so that a failed migration or a dry run can be rolled
+// back.
+type migrationFunc func(tx *bolt.Tx) error
+
+// migrations holds the steps that upgrade the cache database in place, keyed by
+// the cache version they upgrade from. The migration from version N must leave
+// the database in the format expected by version N+1. When incrementing
+// cacheVersionCurrent, register a migration from the previous version here so
+// that users keep their cache.
+var migrations = map[int]migrationFunc{
+	2: migrateV2ToV3,
+}
+
+// migrateV2ToV3 adds the buckets that version 3 uses to track when comics were
+// fetched, what kind of comic each one is, and which downloads failed. The
+// ComicKind of each cached comic is recorded from its metadata. Version 2 did
+// not use comicCacheImageBucketName, Init fills it from the image cache
+// directory.
+func migrateV2ToV3(tx *bolt.Tx) error {
+	for _, name := range [][]byte{
+		comicCacheImageBucketName,
+		comicCacheFetchedAtBucketName,
+		newestComicCheckBucketName,
+		comicKindBucketName,
+		failedDownloadsMetadataBucketName,
+		failedDownloadsImageBucketName,
+	} {
+		_, err := tx.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	metadata := tx.Bucket(comicCacheMetadataBucketName)
+	if metadata == nil {
+		return ErrLocalFailure
+	}
+	return metadata.ForEach(func(k, v []byte) error {
+		n, err := bytesToInt(k)
+		if err != nil {
+			return err
+		}
+		comic, err := xkcd.New(bytes.NewReader(v))
+		if err != nil {
+			// ComicKindOf treats it as an image until it is downloaded
+			// again.
+			log.Printf("error decoding cached comic %v: %v", n, err)
+			return nil
+		}
+		return putComicKind(tx, n, detectComicKind(comic))
+	})
+}
+
+// migrationOpenTimeout is how long to wait for another instance of the app to
+// release the cache database before giving up on a migration.
+const migrationOpenTimeout = 5 * time.Second
+
+// errMigrationDryRun is used to roll back the transaction of a dry run.
+var errMigrationDryRun = errors.New("cache migration dry run")
+
+// MigrateDryRun checks whether the user's existing cache can be upgraded to the
+// current cache version without modifying it. The migrations are run on a copy
+// of the cache database. Must be called before Init.
+func MigrateDryRun() error {
+	return migrateCache(existingCacheVersion(), currentCacheVersion(), true)
+}
+
+// migrateCache upgrades the cache database from version from to version to. If
+// dryRun is true, the migrations are run on a copy of the cache database and
+// their changes are discarded. The cache database is left untouched if an error
+// is returned.
+func migrateCache(from, to int, dryRun bool) error {
+	_, err := os.Stat(comicCacheDBPath())
+	if os.IsNotExist(err) {
+		// There is nothing to migrate, a new cache will be created.
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	steps, err := migrationPath(migrations, from, to)
+	if err != nil {
+		return err
+	}
+
+	var db *bolt.DB
+	if dryRun {
+		db, err = copyCacheDB()
+		if err != nil {
+			return err
+		}
+		defer os.Remove(db.Path())
+	} else {
+		db, err = bolt.Open(comicCacheDBPath(), 0644, &bolt.Options{Timeout: migrationOpenTimeout})
+		if err != nil {
+			return err
+		}
+	}
+	defer db.Close()
+
+	err = runMigrations(db, from, steps, dryRun)
+	if err != nil || dryRun {
+		return err
+	}
+	err = db.Close()
+	if err != nil {
+		return err
+	}
+
+	// Record the new version right away, the migrations must not run twice if
+	// the app exits without calling Close.
+	return writeCacheVersion(to)
+}
+
+// copyCacheDB opens the cache database read only, copies it into a temporary
+// file, and opens the copy. The caller must remove the copy once done with it.
+func copyCacheDB() (*bolt.DB, error) {
+	src, err := bolt.Open(comicCacheDBPath(), 0644, &bolt.Options{ReadOnly: true, Timeout: migrationOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	f, err := os.CreateTemp("", "xkcd-gtk-cache-*.db")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	err = src.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(f.Name(), 0600)
+	})
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	db, err := bolt.Open(f.Name(), 0600, &bolt.Options{Timeout: migrationOpenTimeout})
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return db, nil
+}
+
+// migrationPath returns the migrations needed to upgrade from version from to
+// version to, in order.
+func migrationPath(steps map[int]migrationFunc, from, to int) ([]migrationFunc, error) {
+	if from > to {
+		return nil, fmt.Errorf("can not migrate cache from version %v to older version %v", from, to)
+	}
+
+	var path []migrationFunc
+	for v := from; v < to; v++ {
+		step, ok := steps[v]
+		if !ok {
+			return nil, fmt.Errorf("no migration from cache version %v to %v", v, v+1)
+		}
+		path = append(path, step)
+	}
+	return path, nil
+}
+
+// runMigrations applies steps to db in a single transaction, so that either
+// all of them or none of them take effect. If dryRun is true, the transaction
+// is always rolled back.
+func runMigrations(db *bolt.DB, from int, steps []migrationFunc, dryRun bool) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		for i, step := range steps {
+			v := from + i
+			log.Debugf("migrating cache from version %v to %v (dry run: %v)", v, v+1, dryRun)
+			err := step(tx)
+			if err != nil {
+				return fmt.Errorf("error migrating cache from version %v to %v: %w", v, v+1, err)
+			}
+		}
+		if dryRun {
+			return errMigrationDryRun
+		}
+		return nil
+	})
+	if err == errMigrationDryRun {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMigrationPath(t *testing.T) {
+	steps := map[int]migrationFunc{
+		1: func(*bolt.Tx) error { return nil },
+		2: func(*bolt.Tx) error { return nil },
+	}
+	tests := []struct {
+		from, to int
+		want     int
+		wantErr  bool
+	}{
+		{1, 3, 2, false},
+		{2, 3, 1, false},
+		{3, 3, 0, false},
+		{0, 3, 0, true},
+		{1, 4, 0, true},
+		{3, 2, 0, true},
+	}
+	for _, test := range tests {
+		got, err := migrationPath(steps, test.from, test.to)
+		if (err != nil) != test.wantErr {
+			t.Errorf("migrationPath(%v, %v) error = %v, want error: %v", test.from, test.to, err, test.wantErr)
+		}
+		if len(got) != test.want {
+			t.Errorf("migrationPath(%v, %v) returned %v steps, want %v", test.from, test.to, len(got), test.want)
+		}
+	}
+}
+
+func TestRunMigrations(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bucketName := []byte("test")
+	addBucket := func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket(bucketName)
+		return err
+	}
+	failure := errors.New("failure")
+	fail := func(*bolt.Tx) error { return failure }
+
+	hasBucket := func() bool {
+		var ok bool
+		db.View(func(tx *bolt.Tx) error {
+			ok = tx.Bucket(bucketName) != nil
+			return nil
+		})
+		return ok
+	}
+
+	err = runMigrations(db, 1, []migrationFunc{addBucket}, true)
+	if err != nil {
+		t.Fatal("dry run failed: ", err)
+	}
+	if hasBucket() {
+		t.Fatal("dry run modified the database")
+	}
+
+	err = runMigrations(db, 1, []migrationFunc{addBucket, fail}, false)
+	if !errors.Is(err, failure) {
+		t.Fatalf("failed migration returned %v, want %v", err, failure)
+	}
+	if hasBucket() {
+		t.Fatal("failed migration modified the database")
+	}
+
+	err = runMigrations(db, 1, []migrationFunc{addBucket}, false)
+	if err != nil {
+		t.Fatal("migration failed: ", err)
+	}
+	if !hasBucket() {
+		t.Fatal("migration did not modify the database")
+	}
+}
+
+// writeV2CacheFixture writes a cache database in the format of cache version 2,
+// which only had the metadata and (unused) image buckets.
+func writeV2CacheFixture(t *testing.T) {
+	useTempCacheDir(t)
+	db, err := bolt.Open(comicCacheDBPath(), 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket(comicCacheImageBucketName)
+		if err != nil {
+			return err
+		}
+		metadata, err := tx.CreateBucket(comicCacheMetadataBucketName)
+		if err != nil {
+			return err
+		}
+		err = metadata.Put(intToBytes(353), []byte(`{"num": 353, "img": "https://imgs.xkcd.com/comics/python.png"}`))
+		if err != nil {
+			return err
+		}
+		err = metadata.Put(intToBytes(1608), []byte(`{"num": 1608, "img": "https://imgs.xkcd.com/comics/hoverboard.png"}`))
+		if err != nil {
+			return err
+		}
+		return metadata.Put(intToBytes(2), []byte(`not json`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeCacheVersion(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateV2ToV3(t *testing.T) {
+	writeV2CacheFixture(t)
+	before, err := os.ReadFile(comicCacheDBPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = MigrateDryRun()
+	if err != nil {
+		t.Fatal("dry run failed: ", err)
+	}
+	after, err := os.ReadFile(comicCacheDBPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Fatal("dry run modified the cache database")
+	}
+	if v := existingCacheVersion(); v != 2 {
+		t.Fatalf("cache version after dry run = %v, want 2", v)
+	}
+
+	err = migrateCache(2, 3, false)
+	if err != nil {
+		t.Fatal("migration failed: ", err)
+	}
+	if v := existingCacheVersion(); v != 3 {
+		t.Errorf("cache version after migration = %v, want 3", v)
+	}
+
+	db, err := bolt.Open(comicCacheDBPath(), 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			comicCacheFetchedAtBucketName,
+			newestComicCheckBucketName,
+			comicKindBucketName,
+			failedDownloadsMetadataBucketName,
+			failedDownloadsImageBucketName,
+		} {
+			if tx.Bucket(name) == nil {
+				t.Errorf("bucket %q was not created", name)
+			}
+		}
+		kinds := tx.Bucket(comicKindBucketName)
+		if kinds == nil {
+			return nil
+		}
+		for n, want := range map[int]ComicKind{353: ComicKindImage, 1608: ComicKindInteractive} {
+			data := kinds.Get(intToBytes(n))
+			if len(data) != 1 || ComicKind(data[0]) != want {
+				t.Errorf("kind of comic %v = %v, want %v", n, data, want)
+			}
+		}
+		if data := kinds.Get(intToBytes(2)); data != nil {
+			t.Errorf("kind of undecodable comic 2 = %v, want none", data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rkoesters/xkcd"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// newestComicCheckBucketName is the bucket that remembers the result of
+	// the last successful request for the newest comic, so the next request
+	// can be conditional and so freshness survives restarts.
+	newestComicCheckBucketName = []byte("newest_comic_check")
+
+	newestComicCheckETagKey         = []byte("etag")
+	newestComicCheckLastModifiedKey = []byte("last_modified")
+	newestComicCheckCheckedAtKey    = []byte("checked_at")
+)
+
+// errNotModified is returned by getNewestComicInfo when the server reports
+// that the newest comic has not changed since the validators were issued.
+var errNotModified = errors.New("not modified")
+
+// validators are the HTTP cache validators returned along with the newest
+// comic info.
+type validators struct {
+	ETag         string
+	LastModified string
+}
+
+// getNewestComicInfo is like getComicInfo, but sends a conditional request
+// using v. Returns errNotModified if the server responds with 304 Not
+// Modified, otherwise returns the comic along with its new validators.
+func getNewestComicInfo(ctx context.Context, url string, v validators) (*xkcd.Comic, validators, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, v, err
+	}
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+	resp, err := doRequest(req)
+	recordConnectivity(ctx, err)
+	if err != nil {
+		return nil, v, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, v, errNotModified
+	}
+	err = checkStatus(resp)
+	if err != nil {
+		return nil, v, err
+	}
+	comic, err := xkcd.New(resp.Body)
+	if err != nil {
+		return nil, v, err
+	}
+	return comic, validators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// loadNewestComicCheck returns the validators and time of the last successful
+// check for the newest comic. Returns zero values if there has not been one.
+func loadNewestComicCheck() (validators, time.Time, error) {
+	var (
+		v         validators
+		checkedAt time.Time
+	)
+	err := cacheDB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(newestComicCheckBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+		v.ETag = string(bucket.Get(newestComicCheckETagKey))
+		v.LastModified = string(bucket.Get(newestComicCheckLastModifiedKey))
+		data := bucket.Get(newestComicCheckCheckedAtKey)
+		if data == nil {
+			return nil
+		}
+		return checkedAt.UnmarshalBinary(data)
+	})
+	return v, checkedAt, err
+}
+
+// putNewestComicCheck records a successful check for the newest comic at
+// checkedAt. The validators are only replaced if v is not nil.
+func putNewestComicCheck(v *validators, checkedAt time.Time) error {
+	return cacheDB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(newestComicCheckBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+		if v != nil {
+			err := bucket.Put(newestComicCheckETagKey, []byte(v.ETag))
+			if err != nil {
+				return err
+			}
+			err = bucket.Put(newestComicCheckLastModifiedKey, []byte(v.LastModified))
+			if err != nil {
+				return err
+			}
+		}
+		data, err := checkedAt.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		return bucket.Put(newestComicCheckCheckedAtKey, data)
+	})
+}
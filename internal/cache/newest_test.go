@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetNewestComicInfo(t *testing.T) {
+	const (
+		etag         = `"abc123"`
+		lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(`{"num": 42, "safe_title": "Newest"}`))
+	}))
+	defer srv.Close()
+
+	err := initHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	comic, v, err := getNewestComicInfo(ctx, srv.URL, validators{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comic.Num != 42 {
+		t.Errorf("comic.Num = %v, want 42", comic.Num)
+	}
+	want := validators{ETag: etag, LastModified: lastModified}
+	if v != want {
+		t.Errorf("validators = %+v, want %+v", v, want)
+	}
+
+	_, _, err = getNewestComicInfo(ctx, srv.URL, v)
+	if err != errNotModified {
+		t.Errorf("conditional request: got %v, want %v", err, errNotModified)
+	}
+}
+
+func TestNewestComicCheck(t *testing.T) {
+	useTempCacheDB(t, newestComicCheckBucketName)
+
+	v, checkedAt, err := loadNewestComicCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != (validators{}) || !checkedAt.IsZero() {
+		t.Errorf("empty check = %+v, %v, want zero values", v, checkedAt)
+	}
+
+	first := time.Now().Add(-time.Hour)
+	want := validators{ETag: `"x"`, LastModified: "yesterday"}
+	err = putNewestComicCheck(&want, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A 304 response only updates the time.
+	second := time.Now()
+	err = putNewestComicCheck(nil, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, checkedAt, err = loadNewestComicCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != want {
+		t.Errorf("validators = %+v, want %+v", v, want)
+	}
+	if !checkedAt.Equal(second) {
+		t.Errorf("checkedAt = %v, want %v", checkedAt, second)
+	}
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+)
+
+var (
+	offlineMode = flag.Bool("offline", false, "Do not use network, rely only on local data.")
+)
+
+var (
+	// offlineRequested is set by SetOffline.
+	offlineRequested atomic.Bool
+	// networkUnavailable is set by SetNetworkAvailable.
+	networkUnavailable atomic.Bool
+	// serverUnreachable is true if the last request to the xkcd server failed
+	// without a response.
+	serverUnreachable atomic.Bool
+
+	connectivityObserverMutex   sync.RWMutex
+	connectivityObserverCounter int
+	connectivityObservers       map[int]chan bool
+)
+
+// Offline returns true if the cache must not use the network, either because
+// the user asked for offline mode (see OfflineRequested) or because no network
+// is available (see SetNetworkAvailable).
+func Offline() bool {
+	return OfflineRequested() || networkUnavailable.Load()
+}
+
+// OfflineRequested returns true if the user asked for offline mode, either
+// with the -offline flag or with SetOffline.
+func OfflineRequested() bool {
+	return *offlineMode || offlineRequested.Load()
+}
+
+// SetOffline turns offline mode on or off. Offline mode can not be turned off
+// if it was turned on with the -offline flag.
+func SetOffline(offline bool) {
+	if offlineRequested.Swap(offline) != offline {
+		log.Debugf("offline mode set to %v", offline)
+		notifyConnectivityObservers()
+	}
+}
+
+// SetNetworkAvailable informs the cache whether the system has a network
+// connection (e.g. according to GNetworkMonitor). The cache does not use the
+// network while it is unavailable.
+func SetNetworkAvailable(available bool) {
+	if networkUnavailable.Swap(!available) != !available {
+		log.Debugf("network available set to %v", available)
+		notifyConnectivityObservers()
+	}
+}
+
+// ServingCachedOnly returns true if comics are only being served from the
+// cache, either because the cache is Offline or because the xkcd server could
+// not be reached the last time we tried.
+func ServingCachedOnly() bool {
+	return Offline() || serverUnreachable.Load()
+}
+
+// recordConnectivity updates whether the xkcd server is reachable based on the
+// error returned by the HTTP client for a request made with ctx.
+func recordConnectivity(ctx context.Context, err error) {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		// We gave up, the server may be reachable or not.
+		return
+	}
+	unreachable := err != nil
+	if serverUnreachable.Swap(unreachable) != unreachable {
+		log.Debugf("xkcd server reachable set to %v", !unreachable)
+		notifyConnectivityObservers()
+	}
+}
+
+// AddConnectivityObserver adds ch to the list of observers that will be sent
+// the value of ServingCachedOnly whenever offline mode, network availability,
+// or the reachability of the xkcd server changes. The returned int can be used
+// to remove the added channel from the list of observers using
+// RemoveConnectivityObserver.
+func AddConnectivityObserver(ch chan bool) int {
+	connectivityObserverMutex.Lock()
+	defer connectivityObserverMutex.Unlock()
+
+	if connectivityObservers == nil {
+		connectivityObservers = make(map[int]chan bool)
+	}
+
+	id := connectivityObserverCounter
+	connectivityObserverCounter++
+
+	connectivityObservers[id] = ch
+
+	return id
+}
+
+// RemoveConnectivityObserver removes the observer specified by id from the
+// list of observers. The channel will be closed after calling this function.
+func RemoveConnectivityObserver(id int) {
+	connectivityObserverMutex.Lock()
+	defer connectivityObserverMutex.Unlock()
+
+	close(connectivityObservers[id])
+	delete(connectivityObservers, id)
+}
+
+func notifyConnectivityObservers() {
+	connectivityObserverMutex.RLock()
+	defer connectivityObserverMutex.RUnlock()
+
+	cachedOnly := ServingCachedOnly()
+	for id, ch := range connectivityObservers {
+		log.Debugf("notifying connectivity observer #%v: serving cached only: %v", id, cachedOnly)
+		ch <- cachedOnly
+	}
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestServingCachedOnly(t *testing.T) {
+	defer SetOffline(false)
+	defer SetNetworkAvailable(true)
+	defer recordConnectivity(context.Background(), nil)
+
+	ch := make(chan bool, 8)
+	id := AddConnectivityObserver(ch)
+	defer RemoveConnectivityObserver(id)
+
+	steps := []struct {
+		name       string
+		do         func()
+		offline    bool
+		cachedOnly bool
+	}{
+		{"request failed", func() { recordConnectivity(context.Background(), errors.New("connection refused")) }, false, true},
+		{"request succeeded", func() { recordConnectivity(context.Background(), nil) }, false, false},
+		{"offline mode on", func() { SetOffline(true) }, true, true},
+		{"offline mode off", func() { SetOffline(false) }, false, false},
+		{"network lost", func() { SetNetworkAvailable(false) }, true, true},
+		{"network back", func() { SetNetworkAvailable(true) }, false, false},
+	}
+	for _, step := range steps {
+		step.do()
+		if Offline() != step.offline {
+			t.Errorf("after %v: Offline() = %v, want %v", step.name, Offline(), step.offline)
+		}
+		if ServingCachedOnly() != step.cachedOnly {
+			t.Errorf("after %v: ServingCachedOnly() = %v, want %v", step.name, ServingCachedOnly(), step.cachedOnly)
+		}
+		select {
+		case got := <-ch:
+			if got != step.cachedOnly {
+				t.Errorf("after %v: observer got %v, want %v", step.name, got, step.cachedOnly)
+			}
+		default:
+			t.Errorf("after %v: observer was not notified", step.name)
+		}
+	}
+
+	// Cancelled requests say nothing about connectivity.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	recordConnectivity(ctx, context.Canceled)
+	if ServingCachedOnly() {
+		t.Error("cancelled request marked the server as unreachable")
+	}
+}
@@ -42,3 +42,13 @@ func comicImageDirPath() string {
 func ComicImagePath(n int) string {
 	return filepath.Join(comicImageDirPath(), strconv.Itoa(n))
 }
+
+// ComicImageVariantPath returns the path to variant v of the specified comic
+// image within the cache. The file at the returned path may or may not exist,
+// see ImageInfo.Variants.
+func ComicImageVariantPath(n int, v ImageVariant) string {
+	if v == ImageStandard {
+		return ComicImagePath(n)
+	}
+	return ComicImagePath(n) + "_" + v.String()
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"flag"
+	"sync"
+)
+
+const defaultDownloadWorkers = 8
+
+var (
+	downloadWorkers = flag.Int("download-workers", defaultDownloadWorkers, "Number of comics to download concurrently when filling the cache.")
+)
+
+// parallelism returns the number of workers to use for bulk downloads.
+func parallelism() int {
+	if *downloadWorkers < 1 {
+		return 1
+	}
+	return *downloadWorkers
+}
+
+// forEachComic calls fn for every comic number from 1 to newest using the
+// given number of concurrent workers. forEachComic returns once every call to
+// fn has returned. If ctx is cancelled, no further calls to fn are started and
+// ctx.Err() is returned.
+func forEachComic(ctx context.Context, newest, workers int, fn func(n int)) error {
+	comics := make([]int, 0, max(newest, 0))
+	for n := 1; n <= newest; n++ {
+		comics = append(comics, n)
+	}
+	return forEachComicIn(ctx, comics, workers, fn)
+}
+
+// forEachComicIn is like forEachComic, but calls fn for each comic number in
+// comics.
+func forEachComicIn(ctx context.Context, comics []int, workers int, fn func(n int)) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				fn(n)
+			}
+		}()
+	}
+
+feed:
+	for _, n := range comics {
+		select {
+		case jobs <- n:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+
+	wg.Wait()
+	return ctx.Err()
+}
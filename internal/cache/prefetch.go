@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"flag"
+	"sync"
+
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+)
+
+var (
+	prefetchCount = flag.Int("prefetch", 2, "Number of comics before and after the current comic to download in the background.")
+)
+
+var (
+	// cancelPrefetch stops the ongoing prefetch started by Prefetch. May be
+	// nil.
+	cancelPrefetch      context.CancelFunc
+	cancelPrefetchMutex sync.Mutex
+)
+
+// Prefetch downloads the metadata and images of the comics around comic n in
+// the background (see the -prefetch flag), so that they are ready by the time
+// the user navigates to them. Any previous prefetch that is still running is
+// cancelled. Nothing is downloaded in offline mode or once the image cache
+// reaches its quota. Returns immediately, so it is safe to call in the UI event
+// loop.
+func Prefetch(n int) {
+	if Offline() || *prefetchCount <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelPrefetchMutex.Lock()
+	if cancelPrefetch != nil {
+		cancelPrefetch()
+	}
+	cancelPrefetch = cancel
+	cancelPrefetchMutex.Unlock()
+
+	go func() {
+		defer cancel()
+		err := prefetch(ctx, n)
+		if err != nil && ctx.Err() == nil {
+			log.Print("error prefetching comics: ", err)
+		}
+	}()
+}
+
+func prefetch(ctx context.Context, n int) error {
+	ctx, end, err := begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer end()
+	ctx = withBulkRequests(ctx)
+
+	newest, err := NewestComicInfoFromCache()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range prefetchOrder(n, newest.Num, *prefetchCount) {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		_, err = comicInfo(ctx, m)
+		if err != nil {
+			log.Debugf("error prefetching comic info %v: %v", m, err)
+			continue
+		}
+		if HasComicImage(m) {
+			continue
+		}
+		if imageQuotaReached() {
+			// Prefetching would only evict images that the user has seen.
+			log.Debug("not prefetching comic images, image cache quota reached")
+			return nil
+		}
+		log.Debugf("prefetching comic image %v", m)
+		_, err = downloadComicImage(ctx, m)
+		if err != nil {
+			log.Debugf("error prefetching comic image %v: %v", m, err)
+		}
+	}
+	return nil
+}
+
+// prefetchOrder returns the comics within count of comic n, nearest first and
+// alternating between the next and the previous comic, skipping comics that do
+// not exist.
+func prefetchOrder(n, newest, count int) []int {
+	var comics []int
+	for i := 1; i <= count; i++ {
+		for _, m := range []int{n + i, n - i} {
+			if m < 1 || m > newest || m == 404 {
+				continue
+			}
+			comics = append(comics, m)
+		}
+	}
+	return comics
+}
@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPrefetchOrder(t *testing.T) {
+	tests := []struct {
+		n, newest, count int
+		want             []int
+	}{
+		{10, 20, 2, []int{11, 9, 12, 8}},
+		{1, 20, 2, []int{2, 3}},
+		{20, 20, 2, []int{19, 18}},
+		{403, 500, 1, []int{402}},
+		{10, 20, 0, nil},
+	}
+	for _, test := range tests {
+		got := prefetchOrder(test.n, test.newest, test.count)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("prefetchOrder(%v, %v, %v) = %v, want %v", test.n, test.newest, test.count, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+)
+
+// Operation identifies a cache operation that reports its progress to progress
+// observers (see AddProgressObserver).
+type Operation int
+
+const (
+	// OperationDownloadMetadata fills the comic metadata cache and search
+	// index (see DownloadAllComicMetadata).
+	OperationDownloadMetadata Operation = iota
+	// OperationDownloadImages fills the comic image cache (see
+	// DownloadAllComicImages).
+	OperationDownloadImages
+	// OperationDownloadImage downloads a single comic image (see
+	// DownloadComicImage).
+	OperationDownloadImage
+	// OperationVerifyImages checks the cached comic images (see
+	// VerifyComicImages).
+	OperationVerifyImages
+	// OperationIndexComics adds the cached comic metadata to the search
+	// index (see IndexCachedComics).
+	OperationIndexComics
+)
+
+func (op Operation) String() string {
+	switch op {
+	case OperationDownloadMetadata:
+		return "download metadata"
+	case OperationDownloadImages:
+		return "download images"
+	case OperationDownloadImage:
+		return "download image"
+	case OperationVerifyImages:
+		return "verify images"
+	case OperationIndexComics:
+		return "index comics"
+	default:
+		return "unknown"
+	}
+}
+
+// EventKind is the type of a ProgressEvent.
+type EventKind int
+
+const (
+	// EventStarted is sent once when an operation starts.
+	EventStarted EventKind = iota
+	// EventComicFetched is sent when an operation is done with a comic and
+	// the comic is in the cache (it may have been there already).
+	EventComicFetched
+	// EventFailed is sent when an operation is done with a comic but could
+	// not get it into the cache.
+	EventFailed
+	// EventFinished is sent once when an operation returns.
+	EventFinished
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventStarted:
+		return "started"
+	case EventComicFetched:
+		return "comic fetched"
+	case EventFailed:
+		return "failed"
+	case EventFinished:
+		return "finished"
+	default:
+		return "unknown"
+	}
+}
+
+// ProgressEvent describes the progress of a cache operation.
+type ProgressEvent struct {
+	Kind      EventKind
+	Operation Operation
+
+	// Comic is the comic number for EventComicFetched and EventFailed
+	// events, otherwise 0.
+	Comic int
+	// Bytes is the number of bytes downloaded for Comic, or 0 if nothing
+	// was downloaded or the size is unknown.
+	Bytes int64
+	// Err is why Comic could not be fetched for EventFailed events, or why
+	// the operation stopped early for EventFinished events.
+	Err error
+
+	// Done is the number of comics the operation is done with, out of Total.
+	Done  int
+	Total int
+	// ETA is the estimated time until the operation finishes, or 0 if
+	// unknown.
+	ETA time.Duration
+}
+
+// Stat returns the progress of e's operation as a Stat.
+func (e ProgressEvent) Stat() Stat {
+	return Stat{
+		LatestComicNumber: e.Total,
+		CachedCount:       e.Done,
+	}
+}
+
+var (
+	progressObserverMutex   sync.RWMutex
+	progressObserverCounter int
+	progressObservers       map[int]chan ProgressEvent
+
+	runningOperationsMutex sync.Mutex
+	runningOperations      = make(map[Operation]int)
+)
+
+// ProgressObserverBufferSize is the buffer size that the channels of progress
+// observers should have (see AddProgressObserver).
+const ProgressObserverBufferSize = 256
+
+// AddProgressObserver adds ch to the list of observers that will be sent a
+// ProgressEvent whenever a cache operation makes progress. Operations never
+// wait for observers: events that do not fit in ch are dropped, so ch should be
+// buffered (see ProgressObserverBufferSize) and drained promptly. Events about
+// different comics may arrive out of order when an operation handles several
+// comics at once, but EventStarted always arrives first and EventFinished
+// last. The returned int can be used to remove the added channel from the list
+// of observers using RemoveProgressObserver.
+func AddProgressObserver(ch chan ProgressEvent) int {
+	progressObserverMutex.Lock()
+	defer progressObserverMutex.Unlock()
+
+	if progressObservers == nil {
+		progressObservers = make(map[int]chan ProgressEvent)
+	}
+
+	id := progressObserverCounter
+	progressObserverCounter++
+
+	progressObservers[id] = ch
+
+	return id
+}
+
+// RemoveProgressObserver removes the observer specified by id from the list of
+// observers. The channel will be closed after calling this function.
+func RemoveProgressObserver(id int) {
+	progressObserverMutex.Lock()
+	defer progressObserverMutex.Unlock()
+
+	close(progressObservers[id])
+	delete(progressObservers, id)
+}
+
+// notifyProgressObservers sends e to every progress observer that has room for
+// it.
+func notifyProgressObservers(e ProgressEvent) {
+	progressObserverMutex.RLock()
+	defer progressObserverMutex.RUnlock()
+
+	for id, ch := range progressObservers {
+		select {
+		case ch <- e:
+		default:
+			log.Debugf("progress observer %v is full, dropping %v event", id, e.Kind)
+		}
+	}
+}
+
+// OperationRunning returns true if op is in progress. Useful for observers that
+// start listening after the operation sent EventStarted.
+func OperationRunning(op Operation) bool {
+	runningOperationsMutex.Lock()
+	defer runningOperationsMutex.Unlock()
+	return runningOperations[op] > 0
+}
+
+// progress tracks an operation and publishes its ProgressEvents.
+type progress struct {
+	op    Operation
+	start time.Time
+
+	mutex sync.Mutex
+	total int
+	done  int
+}
+
+// startProgress sends EventStarted for op, which will handle total comics.
+// The returned progress must be finished.
+func startProgress(op Operation, total int) *progress {
+	runningOperationsMutex.Lock()
+	runningOperations[op]++
+	runningOperationsMutex.Unlock()
+
+	log.Debugf("%v started", op)
+	p := &progress{
+		op:    op,
+		start: time.Now(),
+		total: total,
+	}
+	p.notify(ProgressEvent{Kind: EventStarted}, 0)
+	return p
+}
+
+// fetched sends EventComicFetched for comic n.
+func (p *progress) fetched(n int, bytes int64) {
+	p.notify(ProgressEvent{
+		Kind:  EventComicFetched,
+		Comic: n,
+		Bytes: bytes,
+	}, 1)
+}
+
+// failed sends EventFailed for comic n.
+func (p *progress) failed(n int, err error) {
+	p.notify(ProgressEvent{
+		Kind:  EventFailed,
+		Comic: n,
+		Err:   err,
+	}, 1)
+}
+
+// result calls fetched if err is nil, and failed otherwise.
+func (p *progress) result(n int, bytes int64, err error) {
+	if err != nil {
+		p.failed(n, err)
+	} else {
+		p.fetched(n, bytes)
+	}
+}
+
+// finish sends EventFinished. err is why the operation stopped early, if it
+// did.
+func (p *progress) finish(err error) {
+	log.Debugf("%v finished after %v: %v", p.op, time.Since(p.start), err)
+	p.notify(ProgressEvent{
+		Kind: EventFinished,
+		Err:  err,
+	}, 0)
+
+	runningOperationsMutex.Lock()
+	runningOperations[p.op]--
+	runningOperationsMutex.Unlock()
+}
+
+// notify adds done to the number of comics that p is done with, fills in the
+// progress of e, and sends it to the progress observers.
+func (p *progress) notify(e ProgressEvent, done int) {
+	p.mutex.Lock()
+	p.done += done
+	e.Operation = p.op
+	e.Done = p.done
+	e.Total = p.total
+	e.ETA = estimateETA(time.Since(p.start), p.done, p.total)
+	p.mutex.Unlock()
+
+	notifyProgressObservers(e)
+}
+
+// estimateETA returns the time needed to do the remaining comics of total at
+// the rate that done comics took elapsed. Returns 0 if unknown.
+func estimateETA(elapsed time.Duration, done, total int) time.Duration {
+	if done <= 0 || done >= total {
+		return 0
+	}
+	return elapsed / time.Duration(done) * time.Duration(total-done)
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEstimateETA(t *testing.T) {
+	tests := []struct {
+		elapsed     time.Duration
+		done, total int
+		want        time.Duration
+	}{
+		{time.Minute, 0, 10, 0},
+		{time.Minute, 1, 10, 9 * time.Minute},
+		{time.Minute, 5, 10, time.Minute},
+		{time.Minute, 10, 10, 0},
+		{time.Minute, 12, 10, 0},
+	}
+	for _, test := range tests {
+		got := estimateETA(test.elapsed, test.done, test.total)
+		if got != test.want {
+			t.Errorf("estimateETA(%v, %v, %v) = %v, want %v", test.elapsed, test.done, test.total, got, test.want)
+		}
+	}
+}
+
+func TestProgressEvents(t *testing.T) {
+	ch := make(chan ProgressEvent, 10)
+	id := AddProgressObserver(ch)
+
+	errFailed := errors.New("failed")
+	p := startProgress(OperationDownloadImages, 3)
+	if !OperationRunning(OperationDownloadImages) {
+		t.Error("operation should be running after it started")
+	}
+	p.fetched(1, 100)
+	p.result(2, 0, errFailed)
+	p.result(3, 50, nil)
+	p.finish(nil)
+	if OperationRunning(OperationDownloadImages) {
+		t.Error("operation should not be running after it finished")
+	}
+
+	RemoveProgressObserver(id)
+
+	want := []ProgressEvent{
+		{Kind: EventStarted, Total: 3},
+		{Kind: EventComicFetched, Comic: 1, Bytes: 100, Done: 1, Total: 3},
+		{Kind: EventFailed, Comic: 2, Err: errFailed, Done: 2, Total: 3},
+		{Kind: EventComicFetched, Comic: 3, Bytes: 50, Done: 3, Total: 3},
+		{Kind: EventFinished, Done: 3, Total: 3},
+	}
+	var got []ProgressEvent
+	for e := range ch {
+		// The ETA depends on timing.
+		e.ETA = 0
+		got = append(got, e)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v events, want %v: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		want[i].Operation = OperationDownloadImages
+		if got[i] != want[i] {
+			t.Errorf("event %v = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestProgressEventsFullObserver(t *testing.T) {
+	ch := make(chan ProgressEvent, 1)
+	id := AddProgressObserver(ch)
+
+	// Operations carry on without waiting for the observer.
+	p := startProgress(OperationDownloadImages, 3)
+	for n := 1; n <= 3; n++ {
+		p.fetched(n, 0)
+	}
+	p.finish(nil)
+
+	RemoveProgressObserver(id)
+
+	var got []EventKind
+	for e := range ch {
+		got = append(got, e.Kind)
+	}
+	if len(got) != 1 || got[0] != EventStarted {
+		t.Errorf("got events %v, want only %v", got, EventStarted)
+	}
+}
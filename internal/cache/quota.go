@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// imageQuota is the maximum number of bytes the image cache may use. Zero
+	// means unlimited.
+	imageQuota      int64
+	imageQuotaMutex sync.RWMutex
+
+	// isEvictionExempt reports whether the given comic's image must never be
+	// evicted from the image cache. May be nil.
+	isEvictionExempt      func(n int) bool
+	isEvictionExemptMutex sync.RWMutex
+
+	// imageCacheSize is the total size of the images in the image cache in
+	// bytes. It is loaded by loadImageCacheSize, then kept up to date by
+	// putImageInfo and removeComicImage.
+	imageCacheSize      int64
+	imageCacheSizeMutex sync.RWMutex
+
+	// enforceImageQuotaMutex makes sure only one enforceImageQuota evicts
+	// images at a time.
+	enforceImageQuotaMutex sync.Mutex
+
+	// lastViewedImage is the comic whose image was most recently shown to the
+	// user, or 0 if there is none. It is never evicted, so changing the quota
+	// does not delete the comic that is being viewed.
+	lastViewedImage      int
+	lastViewedImageMutex sync.RWMutex
+)
+
+// ImageQuota returns the maximum number of bytes the image cache may use. Zero
+// means unlimited.
+func ImageQuota() int64 {
+	imageQuotaMutex.RLock()
+	defer imageQuotaMutex.RUnlock()
+	return imageQuota
+}
+
+// SetImageQuota sets the maximum number of bytes the image cache may use, then
+// evicts images until the cache fits. Zero means unlimited. Should not be
+// called directly in the UI event loop.
+func SetImageQuota(quota int64) error {
+	imageQuotaMutex.Lock()
+	imageQuota = max(quota, 0)
+	imageQuotaMutex.Unlock()
+
+	return enforceImageQuota(0)
+}
+
+// SetEvictionExemptions sets the function used to decide whether a comic's
+// image must be kept regardless of the image quota (e.g. because it is
+// bookmarked).
+func SetEvictionExemptions(exempt func(n int) bool) {
+	isEvictionExemptMutex.Lock()
+	defer isEvictionExemptMutex.Unlock()
+	isEvictionExempt = exempt
+}
+
+func evictionExempt(n int) bool {
+	lastViewedImageMutex.RLock()
+	viewed := lastViewedImage
+	lastViewedImageMutex.RUnlock()
+	if n == viewed {
+		return true
+	}
+
+	isEvictionExemptMutex.RLock()
+	defer isEvictionExemptMutex.RUnlock()
+	return isEvictionExempt != nil && isEvictionExempt(n)
+}
+
+// MarkComicImageViewed records that comic n's image was just shown to the user.
+// Images that have not been viewed recently are evicted first when the image
+// cache is over its quota. Returns ErrMiss if the image is not in the cache.
+func MarkComicImageViewed(n int) error {
+	lastViewedImageMutex.Lock()
+	lastViewedImage = n
+	lastViewedImageMutex.Unlock()
+
+	return cacheDB.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheImageBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+
+		key := intToBytes(n)
+		data := bucket.Get(key)
+		if data == nil {
+			return ErrMiss
+		}
+
+		var info ImageInfo
+		err := json.Unmarshal(data, &info)
+		if err != nil {
+			return err
+		}
+		info.ViewedAt = time.Now()
+		data, err = json.Marshal(&info)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, data)
+	})
+}
+
+// lastUsed returns when the image was last viewed or downloaded, whichever is
+// more recent.
+func (info *ImageInfo) lastUsed() time.Time {
+	if info.ViewedAt.After(info.FetchedAt) {
+		return info.ViewedAt
+	}
+	return info.FetchedAt
+}
+
+// imageQuotaReached returns true if the image cache has reached its quota.
+func imageQuotaReached() bool {
+	quota := ImageQuota()
+	if quota <= 0 {
+		return false
+	}
+	return currentImageCacheSize() >= quota
+}
+
+// ImageCacheSize returns the total size of the images in the image cache in
+// bytes.
+func ImageCacheSize() int64 {
+	return currentImageCacheSize()
+}
+
+func currentImageCacheSize() int64 {
+	imageCacheSizeMutex.RLock()
+	defer imageCacheSizeMutex.RUnlock()
+	return imageCacheSize
+}
+
+// addImageCacheSize adds delta bytes to the size of the image cache.
+func addImageCacheSize(delta int64) {
+	imageCacheSizeMutex.Lock()
+	defer imageCacheSizeMutex.Unlock()
+	imageCacheSize = max(imageCacheSize+delta, 0)
+}
+
+// loadImageCacheSize sets the size of the image cache from the ImageInfos in
+// the image bucket.
+func loadImageCacheSize() error {
+	_, size, err := countCachedImages()
+	if err != nil {
+		return err
+	}
+	imageCacheSizeMutex.Lock()
+	defer imageCacheSizeMutex.Unlock()
+	imageCacheSize = size
+	return nil
+}
+
+// evictionCandidate is an image that may be evicted from the image cache.
+type evictionCandidate struct {
+	n        int
+	size     int64
+	lastUsed time.Time
+}
+
+// chooseEvictions returns the comics whose images should be evicted so that
+// the total size of images is at most quota, starting with the least recently
+// used images.
+func chooseEvictions(candidates []evictionCandidate, total, quota int64) []int {
+	if quota <= 0 || total <= quota {
+		return nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastUsed.Before(candidates[j].lastUsed)
+	})
+
+	var evict []int
+	for _, c := range candidates {
+		if total <= quota {
+			break
+		}
+		evict = append(evict, c.n)
+		total -= c.size
+	}
+	return evict
+}
+
+// enforceImageQuota evicts the least recently used images until the image
+// cache fits within its quota. The image of comic keep, the most recently
+// viewed image, and the images of exempt comics are never evicted.
+func enforceImageQuota(keep int) error {
+	enforceImageQuotaMutex.Lock()
+	defer enforceImageQuotaMutex.Unlock()
+
+	quota := ImageQuota()
+	if quota <= 0 || currentImageCacheSize() <= quota {
+		return nil
+	}
+
+	var (
+		total      int64
+		candidates []evictionCandidate
+	)
+	err := forEachImageInfo(func(n int, info *ImageInfo) error {
+		total += info.totalSize()
+		if n != keep && !evictionExempt(n) {
+			candidates = append(candidates, evictionCandidate{
+				n:        n,
+				size:     info.totalSize(),
+				lastUsed: info.lastUsed(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, n := range chooseEvictions(candidates, total, quota) {
+		log.Debugf("evicting comic image %v from the image cache", n)
+		err = removeComicImage(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
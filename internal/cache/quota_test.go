@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestChooseEvictions(t *testing.T) {
+	now := time.Now()
+	candidates := func() []evictionCandidate {
+		return []evictionCandidate{
+			{n: 1, size: 100, lastUsed: now.Add(-time.Hour)},
+			{n: 2, size: 200, lastUsed: now.Add(-3 * time.Hour)},
+			{n: 3, size: 300, lastUsed: now},
+			{n: 4, size: 400, lastUsed: now.Add(-2 * time.Hour)},
+		}
+	}
+	tests := []struct {
+		total int64
+		quota int64
+		want  []int
+	}{
+		{1000, 0, nil},
+		{1000, 1000, nil},
+		{1000, 900, []int{2}},
+		{1000, 800, []int{2}},
+		{1000, 700, []int{2, 4}},
+		{1000, 300, []int{2, 4, 1}},
+		{1000, 1, []int{2, 4, 1, 3}},
+	}
+	for _, test := range tests {
+		got := chooseEvictions(candidates(), test.total, test.quota)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("chooseEvictions(total=%v, quota=%v) = %v, want %v", test.total, test.quota, got, test.want)
+		}
+	}
+}
+
+func TestImageCacheSize(t *testing.T) {
+	useTempCacheDir(t)
+	db := useTempCacheDB(t, comicCacheImageBucketName)
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		images := tx.Bucket(comicCacheImageBucketName)
+		return images.Put(intToBytes(1), []byte(`{"Size": 100}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = loadImageCacheSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer addImageCacheSize(-ImageCacheSize())
+
+	check := func(want int64) {
+		t.Helper()
+		if got := ImageCacheSize(); got != want {
+			t.Errorf("ImageCacheSize() = %v, want %v", got, want)
+		}
+	}
+	check(100)
+
+	err = putImageInfo(2, &ImageInfo{Size: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(300)
+
+	// Replacing an image only counts the difference.
+	err = putImageInfo(2, &ImageInfo{Size: 50, Variants: map[ImageVariant]VariantInfo{Image2x: {Size: 25}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(175)
+
+	err = removeComicImage(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(75)
+
+	// Removing an image that is not in the cache changes nothing.
+	err = removeComicImage(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(75)
+}
+
+func TestEnforceImageQuotaKeepsViewedImage(t *testing.T) {
+	useTempCacheDir(t)
+	useTempCacheDB(t, comicCacheImageBucketName)
+
+	err := loadImageCacheSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer addImageCacheSize(-ImageCacheSize())
+
+	now := time.Now()
+	for n, fetchedAt := range map[int]time.Time{
+		1: now.Add(-2 * time.Hour),
+		2: now.Add(-time.Hour),
+		3: now,
+	} {
+		err = putImageInfo(n, &ImageInfo{Size: 100, FetchedAt: fetchedAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = MarkComicImageViewed(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { lastViewedImage = 0 }()
+	// Forget when comic 1 was viewed, so that only being the last viewed image
+	// keeps it from being evicted first.
+	err = putImageInfo(1, &ImageInfo{Size: 100, FetchedAt: now.Add(-2 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imageQuota = 100
+	defer func() { imageQuota = 0 }()
+	err = enforceImageQuota(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n, want := range map[int]bool{1: true, 2: false, 3: false} {
+		if got := HasComicImage(n); got != want {
+			t.Errorf("HasComicImage(%v) = %v, want %v", n, got, want)
+		}
+	}
+}
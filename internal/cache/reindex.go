@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"slices"
+
+	"github.com/rkoesters/xkcd"
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// indexBatchSize is the number of cached comics that are added to the search
+// index at once.
+const indexBatchSize = 100
+
+// IndexCachedComics adds every comic in the metadata cache to the search index,
+// for example after the search index was rebuilt. Progress is reported to
+// progress observers as OperationIndexComics (see AddProgressObserver). Should
+// not be called directly in the UI event loop.
+func IndexCachedComics(ctx context.Context) error {
+	ctx, end, err := begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	return indexCachedComics(ctx, nil)
+}
+
+// IndexMissingComics checks that the search index, which holds indexedCount
+// comics, is consistent with the metadata cache. If the counts differ, then the
+// cached comics for which indexed returns false are added to the search index
+// from the metadata cache, without using the network. The search index may hold
+// more comics than the metadata cache and still be missing some. Progress is
+// reported to progress observers as OperationIndexComics (see
+// AddProgressObserver). Should not be called directly in the UI event loop.
+func IndexMissingComics(ctx context.Context, indexedCount uint64, indexed func(n int) (bool, error)) error {
+	ctx, end, err := begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	var cachedCount int
+	err = cacheDB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheMetadataBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+		cachedCount = bucket.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if indexedCount == uint64(cachedCount) {
+		return nil
+	}
+
+	log.Printf("search index has %v comics but the metadata cache has %v, checking for missing comics", indexedCount, cachedCount)
+	return indexCachedComics(ctx, indexed)
+}
+
+// indexCachedComics adds the comics in the metadata cache to the search index,
+// skipping the comics for which indexed returns true. indexed may be nil.
+func indexCachedComics(ctx context.Context, indexed func(n int) (bool, error)) (err error) {
+	var comics []*xkcd.Comic
+	err = cacheDB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheMetadataBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			comic, err := xkcd.New(bytes.NewReader(v))
+			if err != nil {
+				n, _ := bytesToInt(k)
+				log.Printf("error decoding cached comic %v: %v", n, err)
+				return nil
+			}
+			comics = append(comics, comic)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if indexed != nil {
+		missing := comics[:0]
+		for _, comic := range comics {
+			ok, err := indexed(comic.Num)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				missing = append(missing, comic)
+			}
+		}
+		comics = missing
+		if len(comics) == 0 {
+			return nil
+		}
+		log.Printf("indexing %v comics that are missing from the search index", len(comics))
+	}
+
+	p := startProgress(OperationIndexComics, len(comics))
+	defer func() { p.finish(err) }()
+
+	// Carry on after a batch fails, so that as many comics as possible end
+	// up in the search index, but report the first error.
+	for batch := range slices.Chunk(comics, indexBatchSize) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		berr := addToSearchIndex(batch...)
+		for _, comic := range batch {
+			p.result(comic.Num, 0, berr)
+		}
+		if err == nil {
+			err = berr
+		}
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/rkoesters/xkcd"
+	bolt "go.etcd.io/bbolt"
+)
+
+// setupReindexTest fills a temporary metadata cache with comics 1 to 3, one of
+// which can not be decoded, and returns the comics that are added to the search
+// index.
+func setupReindexTest(t *testing.T) *[]int {
+	db := useTempCacheDB(t, comicCacheMetadataBucketName)
+	initContext()
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		metadata := tx.Bucket(comicCacheMetadataBucketName)
+		err := metadata.Put(intToBytes(1), []byte(`{"num": 1}`))
+		if err != nil {
+			return err
+		}
+		err = metadata.Put(intToBytes(2), []byte(`not json`))
+		if err != nil {
+			return err
+		}
+		return metadata.Put(intToBytes(3), []byte(`{"num": 3}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexed := new([]int)
+	oldIndex := addToSearchIndex
+	addToSearchIndex = func(comics ...*xkcd.Comic) error {
+		for _, comic := range comics {
+			*indexed = append(*indexed, comic.Num)
+		}
+		return nil
+	}
+	t.Cleanup(func() { addToSearchIndex = oldIndex })
+	return indexed
+}
+
+func TestIndexCachedComics(t *testing.T) {
+	indexed := setupReindexTest(t)
+
+	err := IndexCachedComics(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(*indexed)
+	if len(*indexed) != 2 || (*indexed)[0] != 1 || (*indexed)[1] != 3 {
+		t.Errorf("expected comics [1 3] to be indexed, got %v", *indexed)
+	}
+}
+
+func TestIndexMissingComics(t *testing.T) {
+	indexed := setupReindexTest(t)
+	inIndex := func(n int) (bool, error) {
+		return n == 1, nil
+	}
+
+	// The search index is consistent with the metadata cache.
+	err := IndexMissingComics(context.Background(), 3, inIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*indexed) != 0 {
+		t.Errorf("expected no comics to be indexed, got %v", *indexed)
+	}
+
+	// The search index is missing comics.
+	err = IndexMissingComics(context.Background(), 1, inIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*indexed) != 1 || (*indexed)[0] != 3 {
+		t.Errorf("expected comic 3 to be indexed, got %v", *indexed)
+	}
+
+	// The search index holds deleted comics, but is still missing comics.
+	*indexed = nil
+	err = IndexMissingComics(context.Background(), 5, inIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*indexed) != 1 || (*indexed)[0] != 3 {
+		t.Errorf("expected comic 3 to be indexed, got %v", *indexed)
+	}
+}
+
+func TestIndexCachedComicsError(t *testing.T) {
+	setupReindexTest(t)
+	errIndex := errors.New("search index is broken")
+	addToSearchIndex = func(comics ...*xkcd.Comic) error {
+		return errIndex
+	}
+
+	err := IndexCachedComics(context.Background())
+	if err != errIndex {
+		t.Errorf("IndexCachedComics() = %v, want %v", err, errIndex)
+	}
+}
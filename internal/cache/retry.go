@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/rkoesters/xkcd"
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+)
+
+var (
+	downloadRetries = flag.Int("download-retries", 3, "Number of times to retry a comic download after a transient error.")
+)
+
+// statusError is returned when the server responds with an unexpected HTTP
+// status code.
+type statusError struct {
+	url  string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %v %q from %q", e.code, http.StatusText(e.code), e.url)
+}
+
+// checkStatus returns nil if resp has a successful status code. A 404 is
+// reported as xkcd.ErrNotFound, any other failure as a *statusError.
+func checkStatus(resp *http.Response) error {
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return xkcd.ErrNotFound
+	default:
+		return &statusError{
+			url:  resp.Request.URL.String(),
+			code: resp.StatusCode,
+		}
+	}
+}
+
+// isTransient returns true if err might go away if the request is tried again
+// (e.g. timeouts, dropped connections and server errors), and false if err is
+// permanent (e.g. the comic does not exist) or the caller gave up.
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, xkcd.ErrNotFound) || errors.Is(err, ErrOffline) || errors.Is(err, ErrNoComicImage) {
+		return false
+	}
+
+	var se *statusError
+	if errors.As(err, &se) {
+		switch se.code {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		default:
+			return se.code >= 500
+		}
+	}
+
+	// Anything else (e.g. timeouts, refused connections or an unexpected EOF
+	// while reading the response body) is worth another try.
+	return true
+}
+
+// retryPolicy controls how many times and how often a failed download is
+// retried.
+type retryPolicy struct {
+	retries   int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// defaultRetryPolicy returns the retryPolicy configured on the command line.
+func defaultRetryPolicy() retryPolicy {
+	return retryPolicy{
+		retries:   max(*downloadRetries, 0),
+		baseDelay: 500 * time.Millisecond,
+		maxDelay:  15 * time.Second,
+	}
+}
+
+// delay returns how long to wait before retry number attempt (starting at 0).
+// The delay grows exponentially with each attempt, is capped at p.maxDelay, and
+// is randomized between half and all of that value so that concurrent workers
+// do not retry in lockstep. jitter must return a value in [0, 1).
+func (p retryPolicy) delay(attempt int, jitter func() float64) time.Duration {
+	d := p.baseDelay
+	for i := 0; i < attempt && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, p.maxDelay)
+	return d/2 + time.Duration(jitter()*float64(d/2))
+}
+
+// do calls fn until it succeeds, returns a permanent error, ctx is cancelled,
+// or p.retries retries have been made. Returns the last error returned by fn.
+func (p retryPolicy) do(ctx context.Context, name string, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isTransient(err) || attempt >= p.retries {
+			return err
+		}
+
+		d := p.delay(attempt, rand.Float64)
+		log.Debugf("%v failed (%v), retrying in %v", name, err, d)
+
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rkoesters/xkcd"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{xkcd.ErrNotFound, false},
+		{ErrOffline, false},
+		{context.Canceled, false},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), false},
+		{&statusError{code: http.StatusForbidden}, false},
+		{&statusError{code: http.StatusTooManyRequests}, true},
+		{&statusError{code: http.StatusInternalServerError}, true},
+		{&statusError{code: http.StatusServiceUnavailable}, true},
+		{io.ErrUnexpectedEOF, true},
+		{errors.New("connection reset by peer"), true},
+	}
+	for _, test := range tests {
+		got := isTransient(test.err)
+		if got != test.want {
+			t.Errorf("isTransient(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := retryPolicy{
+		retries:   10,
+		baseDelay: time.Second,
+		maxDelay:  10 * time.Second,
+	}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{0, 500 * time.Millisecond, time.Second},
+		{1, time.Second, 2 * time.Second},
+		{2, 2 * time.Second, 4 * time.Second},
+		{3, 4 * time.Second, 8 * time.Second},
+		{4, 5 * time.Second, 10 * time.Second},
+		{100, 5 * time.Second, 10 * time.Second},
+	}
+	for _, test := range tests {
+		low := p.delay(test.attempt, func() float64 { return 0 })
+		high := p.delay(test.attempt, func() float64 { return 0.999999 })
+		if low != test.min {
+			t.Errorf("attempt %v: minimum delay %v, want %v", test.attempt, low, test.min)
+		}
+		if high > test.max || high < test.max-time.Millisecond {
+			t.Errorf("attempt %v: maximum delay %v, want %v", test.attempt, high, test.max)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	p := retryPolicy{
+		retries:   3,
+		baseDelay: time.Millisecond,
+		maxDelay:  time.Millisecond,
+	}
+	ctx := context.Background()
+
+	var calls int
+	err := p.do(ctx, "transient", func() error {
+		calls++
+		return &statusError{code: http.StatusBadGateway}
+	})
+	if err == nil || calls != 4 {
+		t.Errorf("transient error: got %v after %v calls, want error after 4 calls", err, calls)
+	}
+
+	calls = 0
+	err = p.do(ctx, "permanent", func() error {
+		calls++
+		return xkcd.ErrNotFound
+	})
+	if err != xkcd.ErrNotFound || calls != 1 {
+		t.Errorf("permanent error: got %v after %v calls, want %v after 1 call", err, calls, xkcd.ErrNotFound)
+	}
+
+	calls = 0
+	err = p.do(ctx, "recovers", func() error {
+		calls++
+		if calls < 3 {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("recovering error: got %v after %v calls, want nil after 3 calls", err, calls)
+	}
+}
@@ -0,0 +1,277 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rkoesters/xkcd"
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	metadataMaxAge     = flag.Duration("metadata-max-age", 30*24*time.Hour, "How long cached comic metadata is trusted before it is checked for corrections.")
+	revalidateInterval = flag.Duration("revalidate-interval", 24*time.Hour, "How often to check stale comic metadata for corrections in the background. Zero disables the checks.")
+)
+
+const (
+	// revalidateDelay is how long to wait after startup before the first
+	// revalidation pass, so that it does not compete with loading the first
+	// comic.
+	revalidateDelay = time.Minute
+	// revalidateBatchSize limits how many comics a single revalidation pass
+	// refetches, so that a cache full of stale entries is refreshed gradually.
+	revalidateBatchSize = 100
+)
+
+var (
+	// comicCacheFetchedAtBucketName holds when the metadata of each comic in
+	// comicCacheMetadataBucketName was last fetched, encoded with
+	// time.Time.MarshalBinary.
+	comicCacheFetchedAtBucketName = []byte("comic_metadata_fetched_at")
+
+	comicObserverMutex   sync.RWMutex
+	comicObserverCounter int
+	comicObservers       map[int]chan int
+)
+
+// putFetchedAt records t as the time comic n's metadata was fetched.
+func putFetchedAt(tx *bolt.Tx, n int, t time.Time) error {
+	bucket := tx.Bucket(comicCacheFetchedAtBucketName)
+	if bucket == nil {
+		return ErrLocalFailure
+	}
+	data, err := t.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return bucket.Put(intToBytes(n), data)
+}
+
+// ComicInfoFetchedAt returns when comic n's metadata was last fetched from the
+// xkcd API. Returns ErrMiss if the time is unknown.
+func ComicInfoFetchedAt(n int) (time.Time, error) {
+	var t time.Time
+	err := cacheDB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(comicCacheFetchedAtBucketName)
+		if bucket == nil {
+			return ErrLocalFailure
+		}
+		data := bucket.Get(intToBytes(n))
+		if data == nil {
+			return ErrMiss
+		}
+		return t.UnmarshalBinary(data)
+	})
+	return t, err
+}
+
+// StartRevalidation periodically refetches stale comic metadata in the
+// background (see RevalidateComicMetadata) until Cancel is called. Does
+// nothing if disabled with the -revalidate-interval flag.
+func StartRevalidation() {
+	if *revalidateInterval <= 0 {
+		return
+	}
+
+	go func() {
+		delay := revalidateDelay
+		for {
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-closeCtx.Done():
+				t.Stop()
+				return
+			}
+
+			_, err := RevalidateComicMetadata(context.Background())
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Print("error revalidating comic metadata: ", err)
+			}
+			delay = *revalidateInterval
+		}
+	}()
+}
+
+// RevalidateComicMetadata refetches the cached comic metadata that is older
+// than the -metadata-max-age flag, oldest first. Comics whose metadata changed
+// are updated in the cache and the search index, and comic observers are
+// notified (see AddComicObserver). Returns the numbers of the comics that
+// changed. Should not be called directly in the UI event loop.
+func RevalidateComicMetadata(ctx context.Context) ([]int, error) {
+	ctx, end, err := begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	ctx = withBulkRequests(ctx)
+
+	if Offline() {
+		return nil, ErrOffline
+	}
+
+	stale, err := staleComics(time.Now().Add(-*metadataMaxAge), revalidateBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("revalidating metadata of %v comics", len(stale))
+
+	var (
+		changed      []int
+		changedMutex sync.Mutex
+	)
+	err = forEachComicIn(ctx, stale, parallelism(), func(n int) {
+		ok, err := revalidateComic(ctx, n)
+		if err != nil {
+			log.Printf("error revalidating comic %v: %v", n, err)
+			return
+		}
+		if ok {
+			changedMutex.Lock()
+			changed = append(changed, n)
+			changedMutex.Unlock()
+		}
+	})
+
+	sort.Ints(changed)
+	return changed, err
+}
+
+// staleComics returns up to limit cached comics whose metadata was fetched
+// before cutoff (or at an unknown time), oldest first.
+func staleComics(cutoff time.Time, limit int) ([]int, error) {
+	type entry struct {
+		n         int
+		fetchedAt time.Time
+	}
+
+	var stale []entry
+	err := cacheDB.View(func(tx *bolt.Tx) error {
+		metadata := tx.Bucket(comicCacheMetadataBucketName)
+		fetched := tx.Bucket(comicCacheFetchedAtBucketName)
+		if metadata == nil || fetched == nil {
+			return ErrLocalFailure
+		}
+
+		return metadata.ForEach(func(k, _ []byte) error {
+			n, err := bytesToInt(k)
+			if err != nil {
+				return err
+			}
+
+			// Comics without a timestamp were cached by an older version of
+			// the app, so they are treated as the oldest.
+			var t time.Time
+			if data := fetched.Get(k); data != nil {
+				err = t.UnmarshalBinary(data)
+				if err != nil {
+					return err
+				}
+			}
+			if t.Before(cutoff) {
+				stale = append(stale, entry{n, t})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(stale, func(i, j int) bool {
+		return stale[i].fetchedAt.Before(stale[j].fetchedAt)
+	})
+
+	comics := make([]int, 0, min(len(stale), limit))
+	for _, e := range stale[:min(len(stale), limit)] {
+		comics = append(comics, e.n)
+	}
+	return comics, nil
+}
+
+// revalidateComic refetches comic n's metadata and updates the cache if it
+// changed. Returns true if the metadata changed.
+func revalidateComic(ctx context.Context, n int) (bool, error) {
+	old, err := comicInfo(ctx, n)
+	if err != nil {
+		return false, err
+	}
+
+	var fresh *xkcd.Comic
+	err = defaultRetryPolicy().do(ctx, fmt.Sprintf("revalidateComic(%v)", n), func() error {
+		var err error
+		fresh, err = getComicInfo(ctx, comicInfoURL(apiBaseURL, n))
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if *fresh == *old {
+		return false, cacheDB.Batch(func(tx *bolt.Tx) error {
+			return putFetchedAt(tx, n, time.Now())
+		})
+	}
+
+	log.Debugf("metadata of comic %v changed", n)
+	if fresh.Img != old.Img {
+		// The cached image is out of date, it will be downloaded again the
+		// next time the comic is viewed.
+		err = removeComicImage(n)
+		if err != nil {
+			return false, err
+		}
+	}
+	err = putComicInfo(fresh)
+	if err != nil {
+		return false, err
+	}
+	notifyComicObservers(n)
+	return true, nil
+}
+
+// AddComicObserver adds ch to the list of observers that will be sent the
+// number of each comic whose cached metadata changes. The returned int can be
+// used to remove the added channel from the list of observers using
+// RemoveComicObserver.
+func AddComicObserver(ch chan int) int {
+	comicObserverMutex.Lock()
+	defer comicObserverMutex.Unlock()
+
+	if comicObservers == nil {
+		comicObservers = make(map[int]chan int)
+	}
+
+	id := comicObserverCounter
+	comicObserverCounter++
+
+	comicObservers[id] = ch
+
+	return id
+}
+
+// RemoveComicObserver removes the observer specified by id from the list of
+// observers. The channel will be closed after calling this function.
+func RemoveComicObserver(id int) {
+	comicObserverMutex.Lock()
+	defer comicObserverMutex.Unlock()
+
+	close(comicObservers[id])
+	delete(comicObservers, id)
+}
+
+func notifyComicObservers(n int) {
+	comicObserverMutex.RLock()
+	defer comicObserverMutex.RUnlock()
+
+	for id, ch := range comicObservers {
+		log.Debugf("notifying comic observer #%v: comic %v changed", id, n)
+		ch <- n
+	}
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestStaleComics(t *testing.T) {
+	db := useTempCacheDB(t, comicCacheMetadataBucketName, comicCacheFetchedAtBucketName)
+
+	now := time.Now()
+	fetchedAt := map[int]time.Time{
+		1: now.Add(-48 * time.Hour),
+		2: now,
+		3: now.Add(-72 * time.Hour),
+		// Comic 4 has no timestamp.
+		5: now.Add(-time.Hour),
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		metadata := tx.Bucket(comicCacheMetadataBucketName)
+		for n := 1; n <= 5; n++ {
+			err := metadata.Put(intToBytes(n), []byte("{}"))
+			if err != nil {
+				return err
+			}
+			if t, ok := fetchedAt[n]; ok {
+				err = putFetchedAt(tx, n, t)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cutoff := now.Add(-24 * time.Hour)
+	tests := []struct {
+		limit int
+		want  []int
+	}{
+		{10, []int{4, 3, 1}},
+		{2, []int{4, 3}},
+		{0, []int{}},
+	}
+	for _, test := range tests {
+		got, err := staleComics(cutoff, test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("staleComics(limit=%v) = %v, want %v", test.limit, got, test.want)
+		}
+	}
+}
@@ -2,21 +2,22 @@ package cache
 
 import (
 	"errors"
-	"os"
-	"regexp"
+	"io/fs"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/rkoesters/xkcd-gtk/internal/paths"
 	bolt "go.etcd.io/bbolt"
 )
 
-var imageFileNameRegex = regexp.MustCompile("^[0-9][0-9]*$")
-
 // Stat represents a cache statistic.
 type Stat struct {
 	LatestComicNumber int
 	CachedCount       int
+	// Bytes is the disk space used by the cache, or 0 if unknown.
+	Bytes int64
 }
 
 // Complete returns true if s represents a full cache.
@@ -50,36 +51,33 @@ func StatMetadata() (Stat, error) {
 		return s, err
 	}
 	s.LatestComicNumber = latestComic.Num
-	s.CachedCount, err = countCachedMetadata()
+	s.CachedCount, s.Bytes, err = countCachedMetadata()
 	return s, err
 }
 
-func countCachedMetadata() (int, error) {
-	var count int
+func countCachedMetadata() (int, int64, error) {
+	var (
+		count int
+		bytes int64
+	)
 
 	// We are ready to display comic #404, which is an error page rather than an
 	// image.
 	count++
 
 	err := cacheDB.View(func(tx *bolt.Tx) error {
-		var err error
-
 		bucket := tx.Bucket(comicCacheMetadataBucketName)
 		if bucket == nil {
 			return ErrLocalFailure
 		}
 
-		err = bucket.ForEach(func(_, _ []byte) error {
+		return bucket.ForEach(func(_, v []byte) error {
 			count++
+			bytes += int64(len(v))
 			return nil
 		})
-		if err != nil {
-			return err
-		}
-
-		return nil
 	})
-	return count, err
+	return count, bytes, err
 }
 
 // StatImages returns a Stat for the comic image cache. Should not be called
@@ -91,30 +89,45 @@ func StatImages() (Stat, error) {
 		return s, err
 	}
 	s.LatestComicNumber = int(latestComic.Num)
-	s.CachedCount, err = countCachedImages()
+	s.CachedCount, s.Bytes, err = countCachedImages()
 	return s, err
 }
 
-func countCachedImages() (int, error) {
-	var count int
+func countCachedImages() (int, int64, error) {
+	var (
+		count int
+		bytes int64
+	)
 
 	// We are ready to display comic #404, which is an error page rather than an
 	// image.
 	count++
 
-	files, err := os.ReadDir(comicImageDirPath())
-	if err != nil {
-		return count, err
-	}
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		if !imageFileNameRegex.MatchString(file.Name()) {
-			continue
-		}
+	err := forEachImageInfo(func(_ int, info *ImageInfo) error {
 		count++
-	}
+		bytes += info.totalSize()
+		return nil
+	})
+	return count, bytes, err
+}
 
-	return count, nil
+// StatSearchIndex returns the disk space used by the search index in bytes.
+// Should not be called directly in the UI event loop.
+func StatSearchIndex() (int64, error) {
+	var bytes int64
+	err := filepath.WalkDir(paths.SearchIndex(), func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		bytes += fi.Size()
+		return nil
+	})
+	return bytes, err
 }
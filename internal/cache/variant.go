@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rkoesters/xkcd"
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+)
+
+var (
+	downloadHiDPIImages = flag.Bool("download-hidpi-images", false, "Download the high resolution versions of comic images, if available, even if the display is not HiDPI.")
+)
+
+// displayScale is the scale factor of the display that comics are shown on, as
+// set by SetDisplayScale.
+var displayScale atomic.Int32
+
+// SetDisplayScale tells the cache the scale factor of the display that comics
+// are shown on. The high resolution variants of comic images are downloaded
+// along with the standard image if the scale factor is above 1 (or if the
+// -download-hidpi-images flag is given).
+func SetDisplayScale(scale int) {
+	if int(displayScale.Swap(int32(scale))) != scale {
+		log.Debugf("display scale set to %v", scale)
+	}
+}
+
+// shouldDownloadImageVariants returns true if the high resolution variants of
+// comic images should be downloaded.
+func shouldDownloadImageVariants() bool {
+	return *downloadHiDPIImages || displayScale.Load() > 1
+}
+
+// ImageVariant identifies one of the versions of a comic image.
+type ImageVariant int
+
+const (
+	// ImageStandard is the image linked by the comic metadata. It is always
+	// downloaded.
+	ImageStandard ImageVariant = iota
+	// Image2x is a version of the image with twice the resolution, meant for
+	// HiDPI screens.
+	Image2x
+	// ImageLarge is the large version of the image that xkcd links to for big
+	// comics.
+	ImageLarge
+)
+
+// hiDPIImageVariants are the variants that are downloaded in addition to
+// ImageStandard, if available.
+var hiDPIImageVariants = []ImageVariant{Image2x, ImageLarge}
+
+func (v ImageVariant) String() string {
+	switch v {
+	case ImageStandard:
+		return "standard"
+	case Image2x:
+		return "2x"
+	case ImageLarge:
+		return "large"
+	default:
+		return fmt.Sprintf("ImageVariant(%d)", int(v))
+	}
+}
+
+// VariantInfo describes a high resolution variant of a comic image in the
+// image cache.
+type VariantInfo struct {
+	Size  int64
+	Width int
+}
+
+// Densities returns the pixel density of each cached variant of the image,
+// relative to ImageStandard.
+func (info *ImageInfo) Densities() map[ImageVariant]float64 {
+	densities := map[ImageVariant]float64{ImageStandard: 1}
+	for v, vi := range info.Variants {
+		switch {
+		case info.Width > 0 && vi.Width > 0:
+			densities[v] = float64(vi.Width) / float64(info.Width)
+		case v == Image2x:
+			densities[v] = 2
+		}
+	}
+	return densities
+}
+
+// totalSize returns the size in bytes of the image and all of its variants.
+func (info *ImageInfo) totalSize() int64 {
+	size := info.Size
+	for _, vi := range info.Variants {
+		size += vi.Size
+	}
+	return size
+}
+
+// ComicImageVariant returns the cached variant of comic n's image that best
+// suits displaying the image at the given pixel density (the screen's scale
+// factor times the zoom level), along with the density of that variant. Falls
+// back to ImageStandard if no better variant is cached.
+func ComicImageVariant(n int, density float64) (ImageVariant, float64) {
+	info, err := ComicImageInfo(n)
+	if err != nil {
+		return ImageStandard, 1
+	}
+	densities := info.Densities()
+	v := chooseImageVariant(densities, density)
+	return v, densities[v]
+}
+
+// chooseImageVariant returns the variant with the lowest density that is at
+// least density, or the variant with the highest density if none is dense
+// enough.
+func chooseImageVariant(densities map[ImageVariant]float64, density float64) ImageVariant {
+	best := ImageStandard
+	for v, d := range densities {
+		bestD := densities[best]
+		switch {
+		case bestD < density && d > bestD:
+			// The best variant so far is not dense enough, any denser
+			// variant is better.
+			best = v
+		case d >= density && d < bestD:
+			// Both are dense enough, prefer the smaller image.
+			best = v
+		}
+	}
+	return best
+}
+
+// imageVariantURL returns the URL of variant v of comic's image, or false if
+// the comic does not have such a variant. Not every comic has a 2x variant, so
+// the returned URL may not exist.
+func imageVariantURL(comic *xkcd.Comic, v ImageVariant) (string, bool) {
+	switch v {
+	case ImageStandard:
+		return comic.Img, comic.Img != ""
+	case Image2x:
+		return insertBeforeExt(comic.Img, "_2x")
+	case ImageLarge:
+		// Big comics link to their large version, either to the image
+		// itself or to a page showing it.
+		link, err := url.Parse(comic.Link)
+		if err != nil || link.Host == "" {
+			return "", false
+		}
+		if isImageExt(path.Ext(link.Path)) {
+			if link.Scheme == "" {
+				link.Scheme = "https"
+			}
+			return link.String(), true
+		}
+		if strings.Contains(link.Path, "/large") {
+			return insertBeforeExt(comic.Img, "_large")
+		}
+		return "", false
+	default:
+		return "", false
+	}
+}
+
+// insertBeforeExt inserts s before the file extension of the image at rawURL.
+func insertBeforeExt(rawURL, s string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	ext := path.Ext(u.Path)
+	if !isImageExt(ext) {
+		return "", false
+	}
+	u.Path = strings.TrimSuffix(u.Path, ext) + s + ext
+	return u.String(), true
+}
+
+func isImageExt(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".png", ".jpg", ".jpeg", ".gif":
+		return true
+	default:
+		return false
+	}
+}
+
+// downloadImageVariants tries to download the high resolution variants of
+// comic's image and records the ones that exist in info. Failing to download
+// a variant is not an error, the standard image is always available.
+func downloadImageVariants(ctx context.Context, comic *xkcd.Comic, info *ImageInfo) {
+	if info.Width == 0 {
+		info.Width = imageWidth(ComicImagePath(comic.Num))
+	}
+
+	for _, v := range hiDPIImageVariants {
+		if ctx.Err() != nil {
+			return
+		}
+
+		rawURL, ok := imageVariantURL(comic, v)
+		if !ok {
+			continue
+		}
+		imgURL, err := comicImageURL(apiBaseURL, rawURL)
+		if err != nil {
+			continue
+		}
+
+		var vinfo *ImageInfo
+		err = defaultRetryPolicy().do(ctx, fmt.Sprintf("downloadImageVariants(%v, %v)", comic.Num, v), func() error {
+			var err error
+			vinfo, err = fetchComicImage(ctx, imgURL, ComicImageVariantPath(comic.Num, v))
+			return err
+		})
+		if err != nil {
+			log.Debugf("no %v variant of comic image %v: %v", v, comic.Num, err)
+			continue
+		}
+
+		if info.Variants == nil {
+			info.Variants = make(map[ImageVariant]VariantInfo)
+		}
+		info.Variants[v] = VariantInfo{
+			Size:  vinfo.Size,
+			Width: vinfo.Width,
+		}
+	}
+}
+
+// imageWidth returns the width in pixels of the image at path, or 0 if it can
+// not be determined.
+func imageWidth(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0
+	}
+	return config.Width
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/rkoesters/xkcd"
+)
+
+func TestImageVariantURL(t *testing.T) {
+	small := &xkcd.Comic{
+		Img: "https://imgs.xkcd.com/comics/random_number.png",
+	}
+	big := &xkcd.Comic{
+		Img:  "https://imgs.xkcd.com/comics/money.png",
+		Link: "https://xkcd.com/980/large/",
+	}
+	direct := &xkcd.Comic{
+		Img:  "https://imgs.xkcd.com/comics/umwelt.png",
+		Link: "//imgs.xkcd.com/comics/umwelt_the_void.jpg",
+	}
+	interactive := &xkcd.Comic{
+		Img: "https://imgs.xkcd.com/comics/",
+	}
+
+	tests := []struct {
+		comic *xkcd.Comic
+		v     ImageVariant
+		want  string
+		ok    bool
+	}{
+		{small, ImageStandard, "https://imgs.xkcd.com/comics/random_number.png", true},
+		{small, Image2x, "https://imgs.xkcd.com/comics/random_number_2x.png", true},
+		{small, ImageLarge, "", false},
+		{big, ImageLarge, "https://imgs.xkcd.com/comics/money_large.png", true},
+		{direct, ImageLarge, "https://imgs.xkcd.com/comics/umwelt_the_void.jpg", true},
+		{interactive, Image2x, "", false},
+		{interactive, ImageLarge, "", false},
+	}
+	for _, test := range tests {
+		got, ok := imageVariantURL(test.comic, test.v)
+		if got != test.want || ok != test.ok {
+			t.Errorf("imageVariantURL(%q, %v) = %q, %v; want %q, %v", test.comic.Img, test.v, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestChooseImageVariant(t *testing.T) {
+	standardOnly := map[ImageVariant]float64{ImageStandard: 1}
+	all := map[ImageVariant]float64{ImageStandard: 1, Image2x: 2, ImageLarge: 3.5}
+
+	tests := []struct {
+		densities map[ImageVariant]float64
+		density   float64
+		want      ImageVariant
+	}{
+		{standardOnly, 0.5, ImageStandard},
+		{standardOnly, 4, ImageStandard},
+		{all, 0.5, ImageStandard},
+		{all, 1, ImageStandard},
+		{all, 1.25, Image2x},
+		{all, 2, Image2x},
+		{all, 3, ImageLarge},
+		{all, 8, ImageLarge},
+	}
+	for _, test := range tests {
+		got := chooseImageVariant(test.densities, test.density)
+		if got != test.want {
+			t.Errorf("chooseImageVariant(%v, %v) = %v, want %v", test.densities, test.density, got, test.want)
+		}
+	}
+}
+
+func TestImageInfoDensities(t *testing.T) {
+	info := &ImageInfo{
+		Size:  100,
+		Width: 400,
+		Variants: map[ImageVariant]VariantInfo{
+			Image2x:    {Size: 300, Width: 800},
+			ImageLarge: {Size: 900, Width: 1600},
+		},
+	}
+	d := info.Densities()
+	if d[ImageStandard] != 1 || d[Image2x] != 2 || d[ImageLarge] != 4 {
+		t.Errorf("Densities() = %v", d)
+	}
+	if info.totalSize() != 1300 {
+		t.Errorf("totalSize() = %v, want 1300", info.totalSize())
+	}
+
+	// Without widths, only the density of the 2x variant is known.
+	info.Width = 0
+	d = info.Densities()
+	if _, ok := d[ImageLarge]; ok || d[Image2x] != 2 {
+		t.Errorf("Densities() without widths = %v", d)
+	}
+}
+
+func TestShouldDownloadImageVariants(t *testing.T) {
+	defer SetDisplayScale(int(displayScale.Load()))
+
+	SetDisplayScale(1)
+	if shouldDownloadImageVariants() {
+		t.Error("expected variants not to be downloaded for a scale factor of 1")
+	}
+	SetDisplayScale(2)
+	if !shouldDownloadImageVariants() {
+		t.Error("expected variants to be downloaded for a scale factor of 2")
+	}
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"  // Register GIF decoder for verifyImageFile.
+	_ "image/jpeg" // Register JPEG decoder for verifyImageFile.
+	_ "image/png"  // Register PNG decoder for verifyImageFile.
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+)
+
+// tempImageSuffix is the file name suffix of images that are still being
+// downloaded.
+const tempImageSuffix = ".tmp"
+
+// checkImageContentType returns an error if resp does not claim to contain an
+// image. A missing Content-Type header is allowed, the downloaded file will be
+// checked by verifyImageFile anyway.
+func checkImageContentType(resp *http.Response) error {
+	ct := resp.Header.Get("Content-Type")
+	if ct == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return fmt.Errorf("%w: bad Content-Type %q: %v", ErrInvalidImage, ct, err)
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return fmt.Errorf("%w: unexpected Content-Type %q", ErrInvalidImage, mediaType)
+	}
+	return nil
+}
+
+// verifyImageFile returns an error if the file at path can not be decoded as an
+// image.
+func verifyImageFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, _, err = image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	return nil
+}
+
+// removeTempImages deletes partial downloads left behind in the image cache
+// directory, e.g. if the app crashed in the middle of a download.
+func removeTempImages() {
+	matches, err := filepath.Glob(filepath.Join(comicImageDirPath(), "*"+tempImageSuffix))
+	if err != nil {
+		log.Print("error finding partially downloaded images: ", err)
+		return
+	}
+	for _, path := range matches {
+		log.Debugf("removing partially downloaded image %q", path)
+		err = os.Remove(path)
+		if err != nil {
+			log.Print("error removing partially downloaded image: ", err)
+		}
+	}
+}
+
+// VerifyComicImages checks that every comic image in the cache matches its
+// ImageInfo and can be decoded. Corrupt images are removed from the cache and
+// downloaded again. Returns the numbers of the comics whose images were
+// corrupt. Progress is reported to progress observers as OperationVerifyImages
+// (see AddProgressObserver). Should not be called directly in the UI event
+// loop.
+func VerifyComicImages(ctx context.Context) (_ []int, err error) {
+	ctx, end, err := begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	ctx = withBulkRequests(ctx)
+
+	comics, err := cachedImageNumbers()
+	if err != nil {
+		return nil, err
+	}
+	p := startProgress(OperationVerifyImages, len(comics))
+	defer func() { p.finish(err) }()
+
+	var (
+		corrupt      []int
+		corruptMutex sync.Mutex
+	)
+	err = forEachComicIn(ctx, comics, parallelism(), func(n int) {
+		err := verifyComicImage(n)
+		if err == nil {
+			p.fetched(n, 0)
+			return
+		}
+
+		log.Printf("comic image %v is corrupt, downloading again: %v", n, err)
+		corruptMutex.Lock()
+		corrupt = append(corrupt, n)
+		corruptMutex.Unlock()
+
+		err = removeComicImage(n)
+		if err != nil {
+			log.Print("error removing corrupt comic image: ", err)
+			p.failed(n, err)
+			return
+		}
+		bytes, err := downloadComicImage(ctx, n)
+		if err != nil {
+			log.Printf("error downloading comic image %v: %v", n, err)
+		}
+		p.result(n, bytes, err)
+	})
+
+	sort.Ints(corrupt)
+	return corrupt, err
+}
+
+// verifyComicImage returns an error if comic n's cached image does not match
+// its ImageInfo or can not be decoded.
+func verifyComicImage(n int) error {
+	info, err := ComicImageInfo(n)
+	if err != nil {
+		return err
+	}
+
+	path := ComicImagePath(n)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Size() != info.Size {
+		return fmt.Errorf("%w: size is %v bytes, expected %v bytes", ErrInvalidImage, fi.Size(), info.Size)
+	}
+
+	return verifyImageFile(path)
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckImageContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		ok          bool
+	}{
+		{"", true},
+		{"image/png", true},
+		{"image/jpeg; charset=binary", true},
+		{"text/html; charset=utf-8", false},
+		{"application/json", false},
+		{"not a media type;;", false},
+	}
+	for _, test := range tests {
+		resp := &http.Response{Header: make(http.Header)}
+		if test.contentType != "" {
+			resp.Header.Set("Content-Type", test.contentType)
+		}
+		err := checkImageContentType(resp)
+		if test.ok && err != nil {
+			t.Errorf("checkImageContentType(%q) returned error: %v", test.contentType, err)
+		}
+		if !test.ok && !errors.Is(err, ErrInvalidImage) {
+			t.Errorf("checkImageContentType(%q) = %v, want %v", test.contentType, err, ErrInvalidImage)
+		}
+	}
+}
+
+func TestVerifyImageFile(t *testing.T) {
+	dir := t.TempDir()
+
+	good := filepath.Join(dir, "good")
+	f, err := os.Create(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(f, image.NewGray(image.Rect(0, 0, 4, 4)))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = verifyImageFile(good)
+	if err != nil {
+		t.Errorf("verifyImageFile(%q) returned error: %v", good, err)
+	}
+
+	b, err := os.ReadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"truncated": b[:len(b)/2],
+		"html":      []byte("<html><body>502 Bad Gateway</body></html>"),
+		"empty":     nil,
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		err = os.WriteFile(path, data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = verifyImageFile(path)
+		if !errors.Is(err, ErrInvalidImage) {
+			t.Errorf("verifyImageFile(%q) = %v, want %v", name, err, ErrInvalidImage)
+		}
+	}
+}
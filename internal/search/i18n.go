@@ -0,0 +1,7 @@
+package search
+
+import (
+	"github.com/gotk3/gotk3/glib"
+)
+
+var l = glib.Local
@@ -3,49 +3,376 @@
 package search
 
 import (
+	"fmt"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/blevesearch/bleve/v2"
-	"github.com/blevesearch/bleve/v2/search/query"
+	bsearch "github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/highlight/highlighter/html"
 	"github.com/rkoesters/xkcd"
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+)
+
+// Comics added by concurrent calls to Index are written to the search index in
+// a single batch, once the batch holds maxBatchSize comics or maxBatchDelay has
+// passed since the first of them was added.
+const (
+	maxBatchSize  = 100
+	maxBatchDelay = 10 * time.Millisecond
 )
 
 type Index struct {
+	path string
+
+	// mutex guards index, which Rebuild replaces.
+	mutex sync.RWMutex
 	index bleve.Index
+
+	// batchMutex guards batch, the comics waiting to be written to index.
+	batchMutex sync.Mutex
+	batch      *indexBatch
+}
+
+// indexBatch is a group of comics that are written to the search index
+// together.
+type indexBatch struct {
+	comics []*xkcd.Comic
+	timer  *time.Timer
+	write  sync.Once
+	// done is closed once the comics have been written, after which err
+	// holds the result.
+	done chan struct{}
+	err  error
 }
 
 // New initializes and returns a search index. If a search index does not exist
-// at the provided path, then New will attempt to create it..
-func New(path string) (Index, error) {
-	i := Index{}
+// at the provided path, then New will attempt to create it. If the existing
+// search index was built with an older index mapping or is corrupt, then New
+// deletes it and creates a new one in its place. Other errors opening the
+// search index (e.g. it is locked by another process) are returned as is.
+func New(path string) (*Index, error) {
+	i := &Index{path: path}
 
 	var err error
 	i.index, err = bleve.Open(path)
-	if err == bleve.ErrorIndexPathDoesNotExist {
-		mapping := bleve.NewIndexMapping()
-		i.index, err = bleve.New(path, mapping)
+	switch {
+	case err == bleve.ErrorIndexPathDoesNotExist:
+		err = i.create()
+	case isCorrupt(err):
+		log.Printf("rebuilding corrupt search index %q: %v", path, err)
+		err = i.recreate()
+	case err != nil:
+		return nil, err
+	case !i.hasCurrentMapping():
+		log.Printf("rebuilding search index %q with a new index mapping", path)
+		err = i.index.Close()
+		if err != nil {
+			return nil, err
+		}
+		err = i.recreate()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// isCorrupt returns true if err from bleve.Open means that the search index is
+// damaged beyond repair.
+func isCorrupt(err error) bool {
+	switch err {
+	case bleve.ErrorIndexMetaMissing, bleve.ErrorIndexMetaCorrupt, bleve.ErrorUnknownIndexType:
+		return true
+	default:
+		return false
+	}
+}
+
+// create creates a new, empty search index at i.path.
+func (i *Index) create() error {
+	var err error
+	i.index, err = createIndex(i.path)
+	return err
+}
+
+// createIndex creates a new, empty search index at path.
+func createIndex(path string) (bleve.Index, error) {
+	index, err := bleve.New(path, indexMapping)
+	if err != nil {
+		return nil, err
+	}
+	err = index.SetInternal(mappingVersionKey, []byte(strconv.Itoa(mappingVersion)))
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	return index, nil
+}
+
+// recreate deletes whatever is at i.path and creates a new, empty search index
+// in its place. The old search index must already be closed.
+func (i *Index) recreate() error {
+	err := os.RemoveAll(i.path)
+	if err != nil {
+		return err
+	}
+	return i.create()
+}
+
+// hasCurrentMapping returns true if the search index was built with the
+// current index mapping.
+func (i *Index) hasCurrentMapping() bool {
+	v, err := i.index.GetInternal(mappingVersionKey)
+	if err != nil {
+		log.Print("error reading search index mapping version: ", err)
+		return false
+	}
+	return string(v) == strconv.Itoa(mappingVersion)
+}
+
+// Rebuild deletes every comic from the search index by replacing it with a
+// new, empty one. Comics need to be indexed again afterwards. If the new search
+// index can not be put in place, then the old one is kept.
+func (i *Index) Rebuild() error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	log.Printf("rebuilding search index %q", i.path)
+
+	// Build the new search index next to the old one, which stays open
+	// until the new one is ready.
+	newPath := i.path + ".new"
+	oldPath := i.path + ".old"
+	for _, path := range []string{newPath, oldPath} {
+		err := os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+	}
+	defer os.RemoveAll(newPath)
+	index, err := createIndex(newPath)
+	if err != nil {
+		return err
+	}
+	err = index.Close()
+	if err != nil {
+		return err
+	}
+
+	err = i.index.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(i.path, oldPath)
+	if err != nil {
+		return i.reopen(err)
+	}
+	err = os.Rename(newPath, i.path)
+	if err != nil {
+		return i.restore(oldPath, err)
+	}
+	i.index, err = bleve.Open(i.path)
+	if err != nil {
+		return i.restore(oldPath, err)
+	}
+
+	err = os.RemoveAll(oldPath)
+	if err != nil {
+		log.Printf("error removing old search index %q: %v", oldPath, err)
+	}
+	return nil
+}
+
+// restore moves the old search index at oldPath back to i.path and reopens it
+// after Rebuild failed with err. Returns err.
+func (i *Index) restore(oldPath string, err error) error {
+	rerr := os.RemoveAll(i.path)
+	if rerr == nil {
+		rerr = os.Rename(oldPath, i.path)
+	}
+	if rerr != nil {
+		log.Printf("error restoring search index %q: %v", i.path, rerr)
+	}
+	return i.reopen(err)
+}
+
+// reopen opens the search index at i.path again after Rebuild closed it and
+// then failed with err. Returns err.
+func (i *Index) reopen(err error) error {
+	index, rerr := bleve.Open(i.path)
+	if rerr != nil {
+		log.Printf("error reopening search index %q: %v", i.path, rerr)
+		return err
 	}
-	return i, err
+	i.index = index
+	return err
 }
 
 // Close closes the search index.
 func (i *Index) Close() error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
 	return i.index.Close()
 }
 
-// Index adds comic to the search index.
-func (i *Index) Index(comic *xkcd.Comic) error {
-	return i.index.Index(strconv.Itoa(comic.Num), comic)
+// Count returns the number of comics in the search index.
+func (i *Index) Count() (uint64, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return i.index.DocCount()
+}
+
+// Contains returns true if comic n is in the search index.
+func (i *Index) Contains(n int) (bool, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	doc, err := i.index.Document(strconv.Itoa(n))
+	return doc != nil, err
+}
+
+// Index adds comics to the search index. The comics are written together with
+// the comics of concurrent calls to Index in a single bleve.Batch, which is
+// much faster than writing each comic on its own. Index returns once the batch
+// has been written, so the error may be caused by the comics of another call.
+func (i *Index) Index(comics ...*xkcd.Comic) error {
+	if len(comics) == 0 {
+		return nil
+	}
+
+	i.batchMutex.Lock()
+	b := i.batch
+	if b == nil {
+		b = &indexBatch{done: make(chan struct{})}
+		b.timer = time.AfterFunc(maxBatchDelay, func() { i.writeBatch(b) })
+		i.batch = b
+	}
+	b.comics = append(b.comics, comics...)
+	full := len(b.comics) >= maxBatchSize
+	i.batchMutex.Unlock()
+
+	if full {
+		b.timer.Stop()
+		i.writeBatch(b)
+	}
+	<-b.done
+	return b.err
 }
 
-// Search searches the index for the given userQuery.
-func (i *Index) Search(userQuery string) (*bleve.SearchResult, error) {
-	q := query.NewDisjunctionQuery([]query.Query{
-		query.NewQueryStringQuery(userQuery),
-		query.NewFuzzyQuery(userQuery),
+// writeBatch writes the comics of b to the search index, unless that has
+// already been done.
+func (i *Index) writeBatch(b *indexBatch) {
+	i.batchMutex.Lock()
+	if i.batch == b {
+		i.batch = nil
+	}
+	i.batchMutex.Unlock()
+
+	b.write.Do(func() {
+		defer close(b.done)
+		b.err = i.write(b.comics)
 	})
-	searchRequest := bleve.NewSearchRequest(q)
-	searchRequest.Size = 100
+}
+
+// write adds comics to the search index in a single batch.
+func (i *Index) write(comics []*xkcd.Comic) error {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	batch := i.index.NewBatch()
+	for _, comic := range comics {
+		err := batch.Index(strconv.Itoa(comic.Num), newComicDocument(comic))
+		if err != nil {
+			return err
+		}
+	}
+	return i.index.Batch(batch)
+}
+
+// Delete removes comic n from the search index, if it is there.
+func (i *Index) Delete(n int) error {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return i.index.Delete(strconv.Itoa(n))
+}
+
+// SortOrder is the order of search results.
+type SortOrder int
+
+const (
+	// SortRelevance puts the best matches first.
+	SortRelevance SortOrder = iota
+	// SortNewest puts the most recently published comics first.
+	SortNewest
+	// SortOldest puts the earliest published comics first.
+	SortOldest
+	// SortNumber orders comics by number, starting with the lowest.
+	SortNumber
+)
+
+// sortFields are the bleve sort fields of each SortOrder. Comics with the same
+// publication date are ordered by number.
+var sortFields = map[SortOrder][]string{
+	SortRelevance: {"-_score", fieldNum},
+	SortNewest:    {"-" + fieldDate, "-" + fieldNum},
+	SortOldest:    {fieldDate, fieldNum},
+	SortNumber:    {fieldNum},
+}
+
+// Search searches the index for the given userQuery and returns up to limit
+// results in the given order, skipping the first offset results. The Total of
+// the returned result counts every match, not just the returned ones. Returns a
+// *SyntaxError if userQuery is malformed (see query.go for the query
+// language).
+func (i *Index) Search(userQuery string, offset, limit int, order SortOrder) (*bleve.SearchResult, error) {
+	q, err := parseQuery(userQuery)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := sortFields[order]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort order %v", order)
+	}
+	searchRequest := bleve.NewSearchRequestOptions(q, limit, offset, false)
+	searchRequest.SortBy(fields)
 	searchRequest.Fields = []string{"*"}
+	searchRequest.Highlight = bleve.NewHighlightWithStyle(html.Name)
+	for _, field := range snippetFields {
+		searchRequest.Highlight.AddField(field)
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
 	return i.index.Search(searchRequest)
 }
+
+// Search results carry snippets of the fields below, in order of preference.
+// The title is left out because it is always shown with the search result.
+var snippetFields = []string{fieldAlt, fieldTranscript}
+
+// The matched words in snippets are between SnippetMatchStart and
+// SnippetMatchEnd.
+const (
+	SnippetMatchStart = "<mark>"
+	SnippetMatchEnd   = "</mark>"
+)
+
+// Snippet returns a fragment of the field of hit that best matches the search
+// query. The fragment is escaped HTML, except for the markers around matched
+// words (see SnippetMatchStart). Returns "" if there is no fragment to show.
+func Snippet(hit *bsearch.DocumentMatch) string {
+	var snippet string
+	var best int
+	for _, field := range snippetFields {
+		fragment := strings.Join(hit.Fragments[field], " ")
+		matches := strings.Count(fragment, SnippetMatchStart)
+		if matches > best {
+			snippet = fragment
+			best = matches
+		}
+	}
+	return snippet
+}
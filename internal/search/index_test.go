@@ -1,10 +1,13 @@
 package search_test
 
 import (
+	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"testing"
 
+	"github.com/blevesearch/bleve/v2"
 	"github.com/rkoesters/xkcd"
 	"github.com/rkoesters/xkcd-gtk/internal/search"
 )
@@ -12,6 +15,7 @@ import (
 const (
 	testComicNumber = 404
 	testComicTitle  = "test comic"
+	testSearchLimit = 100
 )
 
 func TestSearchIndex(t *testing.T) {
@@ -31,7 +35,7 @@ func TestSearchIndex(t *testing.T) {
 		t.Errorf("error indexing comic %q: %v", comic, err)
 	}
 
-	results, err := si.Search(testComicTitle)
+	results, err := si.Search(testComicTitle, 0, testSearchLimit, search.SortRelevance)
 	if err != nil {
 		si.Close()
 		t.Fatalf("error searching index with query %q: %v", testComicTitle, err)
@@ -57,3 +61,240 @@ func TestSearchIndex(t *testing.T) {
 		t.Error("error closing search index: ", err)
 	}
 }
+
+func TestSearchIndexStemming(t *testing.T) {
+	si, err := search.New(filepath.Join(t.TempDir(), "search"))
+	if err != nil {
+		t.Fatal("error creating test search index: ", err)
+	}
+	defer si.Close()
+
+	err = si.Index(&xkcd.Comic{Num: 1, Title: "Barrel", Alt: "He keeps running."})
+	if err != nil {
+		t.Fatal("error indexing comic: ", err)
+	}
+
+	results, err := si.Search("runs", 0, testSearchLimit, search.SortRelevance)
+	if err != nil {
+		t.Fatal("error searching index: ", err)
+	}
+	if results.Total != 1 {
+		t.Errorf("expected 1 result, got %v", results.Total)
+	}
+}
+
+func TestSearchIndexTitleBoost(t *testing.T) {
+	si, err := search.New(filepath.Join(t.TempDir(), "search"))
+	if err != nil {
+		t.Fatal("error creating test search index: ", err)
+	}
+	defer si.Close()
+
+	comics := []*xkcd.Comic{
+		{Num: 1, Title: "Lasers", Alt: "Physics is fun."},
+		{Num: 2, Title: "Physics", Alt: "Lasers are fun."},
+	}
+	for _, comic := range comics {
+		err = si.Index(comic)
+		if err != nil {
+			t.Fatal("error indexing comic: ", err)
+		}
+	}
+
+	results, err := si.Search("physics", 0, testSearchLimit, search.SortRelevance)
+	if err != nil {
+		t.Fatal("error searching index: ", err)
+	}
+	if len(results.Hits) != 2 {
+		t.Fatalf("expected 2 results, got %v", len(results.Hits))
+	}
+	if results.Hits[0].ID != "2" {
+		t.Errorf("expected comic with matching title first, got %v", results.Hits[0].ID)
+	}
+	if title := results.Hits[0].Fields["title"]; title != "Physics" {
+		t.Errorf("expected stored title %q, got %v", "Physics", title)
+	}
+	if num := results.Hits[0].Fields["num"]; num != float64(2) {
+		t.Errorf("expected stored num 2, got %v", num)
+	}
+}
+
+func TestSearchIndexBatch(t *testing.T) {
+	si, err := search.New(filepath.Join(t.TempDir(), "search"))
+	if err != nil {
+		t.Fatal("error creating test search index: ", err)
+	}
+	defer si.Close()
+
+	// Many comics at once, more than fit in a single batch.
+	var comics []*xkcd.Comic
+	for n := 1; n <= 250; n++ {
+		comics = append(comics, &xkcd.Comic{Num: n, Title: testComicTitle})
+	}
+	err = si.Index(comics...)
+	if err != nil {
+		t.Fatal("error indexing comics: ", err)
+	}
+
+	// Concurrent calls, which are written together.
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for n := 251; n <= 300; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- si.Index(&xkcd.Comic{Num: n, Title: testComicTitle})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error("error indexing comic: ", err)
+		}
+	}
+
+	count, err := si.Count()
+	if err != nil {
+		t.Fatal("error counting comics: ", err)
+	}
+	if count != 300 {
+		t.Errorf("expected 300 comics, got %v", count)
+	}
+}
+
+func TestSearchIndexRebuild(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "search")
+
+	// An index built without a mapping version needs to be rebuilt.
+	old, err := bleve.New(path, bleve.NewIndexMapping())
+	if err != nil {
+		t.Fatal("error creating old search index: ", err)
+	}
+	err = old.Index("1", &xkcd.Comic{Num: 1, Title: testComicTitle})
+	if err != nil {
+		t.Fatal("error indexing comic: ", err)
+	}
+	err = old.Close()
+	if err != nil {
+		t.Fatal("error closing old search index: ", err)
+	}
+
+	si, err := search.New(path)
+	if err != nil {
+		t.Fatal("error opening search index: ", err)
+	}
+	results, err := si.Search(testComicTitle, 0, testSearchLimit, search.SortRelevance)
+	if err != nil {
+		t.Fatal("error searching index: ", err)
+	}
+	if results.Total != 0 {
+		t.Errorf("expected rebuilt index to be empty, got %v results", results.Total)
+	}
+	err = si.Index(&xkcd.Comic{Num: 2, Title: testComicTitle})
+	if err != nil {
+		t.Fatal("error indexing comic: ", err)
+	}
+	err = si.Close()
+	if err != nil {
+		t.Fatal("error closing search index: ", err)
+	}
+
+	// The rebuilt index has the current mapping version.
+	si, err = search.New(path)
+	if err != nil {
+		t.Fatal("error opening search index: ", err)
+	}
+	defer si.Close()
+	count, err := si.Count()
+	if err != nil {
+		t.Fatal("error counting comics: ", err)
+	}
+	if count != 1 {
+		t.Errorf("expected existing search index with 1 comic to be opened, got %v comics", count)
+	}
+}
+
+func TestSearchIndexCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "search")
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(path, "index_meta.json"), []byte("not json"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	si, err := search.New(path)
+	if err != nil {
+		t.Fatal("error opening corrupt search index: ", err)
+	}
+	defer si.Close()
+	count, err := si.Count()
+	if err != nil {
+		t.Fatal("error counting comics: ", err)
+	}
+	if count != 0 {
+		t.Errorf("expected corrupt search index to be rebuilt empty, got %v comics", count)
+	}
+}
+
+func TestSearchIndexCountAndRebuild(t *testing.T) {
+	dir := t.TempDir()
+	si, err := search.New(filepath.Join(dir, "search"))
+	if err != nil {
+		t.Fatal("error creating test search index: ", err)
+	}
+	defer si.Close()
+
+	for _, n := range []int{1, 2} {
+		err = si.Index(&xkcd.Comic{Num: n, Title: testComicTitle})
+		if err != nil {
+			t.Fatal("error indexing comic: ", err)
+		}
+	}
+
+	count, err := si.Count()
+	if err != nil {
+		t.Fatal("error counting comics: ", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 comics, got %v", count)
+	}
+	for n, want := range map[int]bool{1: true, 2: true, 3: false} {
+		got, err := si.Contains(n)
+		if err != nil {
+			t.Fatal("error looking up comic: ", err)
+		}
+		if got != want {
+			t.Errorf("expected Contains(%v) to be %v, got %v", n, want, got)
+		}
+	}
+
+	err = si.Rebuild()
+	if err != nil {
+		t.Fatal("error rebuilding search index: ", err)
+	}
+	count, err = si.Count()
+	if err != nil {
+		t.Fatal("error counting comics: ", err)
+	}
+	if count != 0 {
+		t.Errorf("expected rebuilt search index to be empty, got %v comics", count)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the rebuilt search index to be left, got %v", entries)
+	}
+	results, err := si.Search(testComicTitle, 0, testSearchLimit, search.SortRelevance)
+	if err != nil {
+		t.Fatal("error searching rebuilt index: ", err)
+	}
+	if results.Total != 0 {
+		t.Errorf("expected no results, got %v", results.Total)
+	}
+}
@@ -0,0 +1,134 @@
+package search
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/rkoesters/xkcd"
+)
+
+// mappingVersion must be incremented whenever indexMapping or comicDocument
+// changes, so that existing search indexes are rebuilt with the new mapping.
+const mappingVersion = 2
+
+// mappingVersionKey is the internal key of the search index that holds the
+// mappingVersion the index was built with.
+var mappingVersionKey = []byte("mapping_version")
+
+// comicDocumentType is the document type of comicDocument in the index
+// mapping.
+const comicDocumentType = "comic"
+
+// Names of the fields of comicDocument.
+const (
+	fieldNum        = "num"
+	fieldTitle      = "title"
+	fieldSafeTitle  = "safe_title"
+	fieldAlt        = "alt"
+	fieldTranscript = "transcript"
+	fieldDate       = "date"
+
+	// fieldWords holds the words of the title, alt text and transcript
+	// without stemming, to suggest search terms from.
+	fieldWords = "words"
+)
+
+// fieldBoosts is how much a match in each text field counts towards the score
+// of a search result. Bleve has no index time boosts, so these are applied to
+// the queries instead.
+var fieldBoosts = map[string]float64{
+	fieldTitle:      5,
+	fieldSafeTitle:  5,
+	fieldAlt:        2,
+	fieldTranscript: 1,
+}
+
+// comicDocument is what the search index stores for each comic.
+type comicDocument struct {
+	Num        int    `json:"num"`
+	Title      string `json:"title"`
+	SafeTitle  string `json:"safe_title"`
+	Alt        string `json:"alt"`
+	Transcript string `json:"transcript"`
+	// Date is nil if the comic does not have a valid publication date.
+	Date *time.Time `json:"date"`
+}
+
+// Type implements bleve's mapping.Classifier, which picks the document mapping
+// used to index comicDocuments.
+func (comicDocument) Type() string {
+	return comicDocumentType
+}
+
+func newComicDocument(comic *xkcd.Comic) comicDocument {
+	return comicDocument{
+		Num:        comic.Num,
+		Title:      comic.Title,
+		SafeTitle:  comic.SafeTitle,
+		Alt:        comic.Alt,
+		Transcript: comic.Transcript,
+		Date:       comicDate(comic),
+	}
+}
+
+// comicDate returns the publication date of comic, or nil if comic does not
+// have a valid date.
+func comicDate(comic *xkcd.Comic) *time.Time {
+	year, err := strconv.Atoi(comic.Year)
+	if err != nil {
+		return nil
+	}
+	month, err := strconv.Atoi(comic.Month)
+	if err != nil {
+		return nil
+	}
+	day, err := strconv.Atoi(comic.Day)
+	if err != nil {
+		return nil
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	return &date
+}
+
+// indexMapping is the mapping of comicDocuments into the search index.
+var indexMapping = newIndexMapping()
+
+func newIndexMapping() *mapping.IndexMappingImpl {
+	textField := func(analyzer string) *mapping.FieldMapping {
+		fm := bleve.NewTextFieldMapping()
+		fm.Analyzer = analyzer
+		fm.Store = true
+		return fm
+	}
+
+	// words is added to each field that search terms are suggested from.
+	words := bleve.NewTextFieldMapping()
+	words.Name = fieldWords
+	words.Analyzer = standard.Name
+	words.IncludeInAll = false
+	words.IncludeTermVectors = false
+
+	num := bleve.NewNumericFieldMapping()
+	num.Store = true
+
+	date := bleve.NewDateTimeFieldMapping()
+	date.Store = true
+
+	doc := bleve.NewDocumentStaticMapping()
+	doc.AddFieldMappingsAt(fieldNum, num)
+	doc.AddFieldMappingsAt(fieldTitle, textField(standard.Name), words)
+	doc.AddFieldMappingsAt(fieldSafeTitle, textField(standard.Name))
+	doc.AddFieldMappingsAt(fieldAlt, textField(en.AnalyzerName), words)
+	doc.AddFieldMappingsAt(fieldTranscript, textField(en.AnalyzerName), words)
+	doc.AddFieldMappingsAt(fieldDate, date)
+
+	im := bleve.NewIndexMapping()
+	im.AddDocumentMapping(comicDocumentType, doc)
+	im.DefaultType = comicDocumentType
+	im.DefaultAnalyzer = standard.Name
+	return im
+}
@@ -0,0 +1,541 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// The query language accepted by Index.Search looks like:
+//
+//	physics year:2012
+//	title:"bobby tables" OR alt:sql
+//	num:1000..1100 -transcript:megan
+//	(date:2010-01-01..2010-06-30 OR year:2015..) NOT chess
+//
+// Terms next to each other must all match. Terms can be combined with the AND,
+// OR and NOT operators, negated with a leading "-", and grouped with
+// parentheses. Double quotes match a phrase. A term can be limited to a field
+// with one of the filters below. The num, year and date filters accept a single
+// value or a range like "a..b", where either end can be left out.
+
+// SyntaxError is returned by Index.Search when the query is malformed.
+type SyntaxError struct {
+	// Offset is where in the query the error was found, in characters.
+	Offset int
+	// Msg describes the error in the user's language.
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf(l("%v (at character %v)"), e.Msg, e.Offset+1)
+}
+
+// Names of the query filters.
+const (
+	filterNum        = "num"
+	filterYear       = "year"
+	filterDate       = "date"
+	filterTitle      = "title"
+	filterAlt        = "alt"
+	filterTranscript = "transcript"
+)
+
+// filterNames are the names of the query filters. Other words that end in a
+// colon are searched for like any other word.
+var filterNames = map[string]bool{
+	filterNum:        true,
+	filterYear:       true,
+	filterDate:       true,
+	filterTitle:      true,
+	filterAlt:        true,
+	filterTranscript: true,
+}
+
+// filterTextFields are the fields searched by each text filter.
+var filterTextFields = map[string][]string{
+	filterTitle:      {fieldTitle, fieldSafeTitle},
+	filterAlt:        {fieldAlt},
+	filterTranscript: {fieldTranscript},
+}
+
+// Years outside of this range are rejected by the year and date filters, as
+// the search index can not represent dates far from the present.
+const (
+	minYear = 1900
+	maxYear = 2200
+)
+
+// numBoost is how much a comic number that matches a plain number counts
+// towards the score of a search result, so that searching for a number shows
+// that comic first.
+const numBoost = 10
+
+// dateLayout is the layout of dates in the date filter.
+const dateLayout = "2006-01-02"
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenPhrase
+	tokenFilter // A filter name followed by a colon.
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLeftParen
+	tokenRightParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// offset is where the token starts in the query, in characters.
+	offset int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return l("end of query")
+	case tokenPhrase:
+		return strconv.Quote(t.text)
+	case tokenFilter:
+		return strconv.Quote(t.text + ":")
+	default:
+		return strconv.Quote(t.text)
+	}
+}
+
+// lex splits userQuery into tokens. The last token is always tokenEOF.
+func lex(userQuery string) ([]token, error) {
+	var tokens []token
+	runes := []rune(userQuery)
+	i := 0
+	for {
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+		if i == len(runes) {
+			return append(tokens, token{kind: tokenEOF, offset: i}), nil
+		}
+
+		start := i
+		switch r := runes[i]; {
+		case r == '(':
+			tokens = append(tokens, token{tokenLeftParen, "(", start})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenRightParen, ")", start})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &SyntaxError{start, l("missing closing quote")}
+			}
+			tokens = append(tokens, token{tokenPhrase, string(runes[i+1 : end]), start})
+			i = end + 1
+		case r == '-' && i+1 < len(runes) && !isWordBoundary(runes[i+1]):
+			tokens = append(tokens, token{tokenNot, "-", start})
+			i++
+		default:
+			for i < len(runes) && !isWordBoundary(runes[i]) {
+				i++
+				if runes[i-1] == ':' && filterNames[string(runes[start:i-1])] {
+					break
+				}
+			}
+			word := string(runes[start:i])
+			switch {
+			case strings.HasSuffix(word, ":") && filterNames[strings.TrimSuffix(word, ":")]:
+				tokens = append(tokens, token{tokenFilter, strings.TrimSuffix(word, ":"), start})
+			case word == "AND":
+				tokens = append(tokens, token{tokenAnd, word, start})
+			case word == "OR":
+				tokens = append(tokens, token{tokenOr, word, start})
+			case word == "NOT":
+				tokens = append(tokens, token{tokenNot, word, start})
+			default:
+				tokens = append(tokens, token{tokenWord, word, start})
+			}
+		}
+	}
+}
+
+func isWordBoundary(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+}
+
+// parser turns tokens into a bleve query. Its grammar is:
+//
+//	query   = and { "OR" and }
+//	and     = unary { [ "AND" ] unary }
+//	unary   = [ "NOT" | "-" ] primary
+//	primary = "(" query ")" | [ filter ] ( word | phrase )
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parseQuery parses userQuery into a bleve query.
+func parseQuery(userQuery string) (query.Query, error) {
+	tokens, err := lex(userQuery)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return query.NewMatchNoneQuery(), nil
+	}
+
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &SyntaxError{t.offset, fmt.Sprintf(l("unexpected %v"), t)}
+	}
+	if q == nil {
+		// The query only had words that are too common to search for.
+		return query.NewMatchNoneQuery(), nil
+	}
+	return q, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (query.Query, error) {
+	var queries []query.Query
+	for {
+		q, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if q != nil {
+			queries = append(queries, q)
+		}
+		if p.peek().kind != tokenOr {
+			break
+		}
+		p.next()
+	}
+
+	switch len(queries) {
+	case 0:
+		return nil, nil
+	case 1:
+		return queries[0], nil
+	default:
+		return query.NewDisjunctionQuery(queries), nil
+	}
+}
+
+func (p *parser) parseAnd() (query.Query, error) {
+	var must, mustNot []query.Query
+	for {
+		negate, q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if q != nil && negate {
+			mustNot = append(mustNot, q)
+		} else if q != nil {
+			must = append(must, q)
+		}
+
+		switch p.peek().kind {
+		case tokenEOF, tokenOr, tokenRightParen:
+			return newBooleanQuery(must, mustNot), nil
+		case tokenAnd:
+			p.next()
+		}
+	}
+}
+
+// newBooleanQuery returns a query that matches documents that match all of must
+// and none of mustNot, or nil if both are empty.
+func newBooleanQuery(must, mustNot []query.Query) query.Query {
+	if len(mustNot) == 0 {
+		switch len(must) {
+		case 0:
+			return nil
+		case 1:
+			return must[0]
+		default:
+			return query.NewConjunctionQuery(must)
+		}
+	}
+	if len(must) == 0 {
+		must = []query.Query{query.NewMatchAllQuery()}
+	}
+	return query.NewBooleanQuery(must, nil, mustNot)
+}
+
+// parseUnary returns the next term and whether it is negated. The returned
+// query is nil if the term is too common to search for.
+func (p *parser) parseUnary() (bool, query.Query, error) {
+	negate := false
+	if p.peek().kind == tokenNot {
+		p.next()
+		negate = true
+	}
+	q, err := p.parsePrimary()
+	return negate, q, err
+}
+
+func (p *parser) parsePrimary() (query.Query, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenLeftParen:
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRightParen {
+			return nil, &SyntaxError{t.offset, l("missing closing parenthesis")}
+		}
+		return q, nil
+	case tokenWord:
+		return newTextQuery(t.text, false, nil), nil
+	case tokenPhrase:
+		return newTextQuery(t.text, true, nil), nil
+	case tokenFilter:
+		value := p.next()
+		if value.kind != tokenWord && value.kind != tokenPhrase {
+			return nil, &SyntaxError{value.offset, fmt.Sprintf(l("expected a value for %v, got %v"), t, value)}
+		}
+		return newFilterQuery(t, value)
+	default:
+		return nil, &SyntaxError{t.offset, fmt.Sprintf(l("expected a search term, got %v"), t)}
+	}
+}
+
+// newFilterQuery returns the query for a filter with the given value.
+func newFilterQuery(filter, value token) (query.Query, error) {
+	if fields, ok := filterTextFields[filter.text]; ok {
+		return newTextQuery(value.text, value.kind == tokenPhrase, fields), nil
+	}
+
+	switch filter.text {
+	case filterNum:
+		return newNumQuery(value)
+	case filterYear:
+		return newYearQuery(value)
+	case filterDate:
+		return newDateQuery(value)
+	}
+	// lex only makes filter tokens for the names in filterNames.
+	panic("unknown filter " + filter.text)
+}
+
+// newTextQuery returns a query that matches text in fields, or in all text
+// fields if fields is nil. Returns nil if text is too common to search for.
+func newTextQuery(text string, phrase bool, fields []string) query.Query {
+	if !hasSearchableTerms(text) {
+		return nil
+	}
+
+	boosted := fields == nil
+	if boosted {
+		for field := range fieldBoosts {
+			fields = append(fields, field)
+		}
+	}
+
+	var queries []query.Query
+	for _, field := range fields {
+		boost := 1.0
+		if boosted {
+			boost = fieldBoosts[field]
+		}
+		queries = append(queries, newFieldQuery(text, phrase, field, boost))
+	}
+
+	if boosted && !phrase {
+		// Forgive typos in the title.
+		fuzzy := query.NewMatchQuery(text)
+		fuzzy.SetField(fieldTitle)
+		fuzzy.SetFuzziness(1)
+		queries = append(queries, fuzzy)
+
+		if n, err := strconv.Atoi(text); err == nil {
+			num := newNumRangeQuery(n, n)
+			num.SetBoost(numBoost)
+			queries = append(queries, num)
+		}
+	}
+
+	if len(queries) == 1 {
+		return queries[0]
+	}
+	return query.NewDisjunctionQuery(queries)
+}
+
+// newFieldQuery returns a query that matches text in field.
+func newFieldQuery(text string, phrase bool, field string, boost float64) query.Query {
+	if phrase {
+		q := query.NewMatchPhraseQuery(text)
+		q.SetField(field)
+		q.SetBoost(boost)
+		return q
+	}
+	q := query.NewMatchQuery(text)
+	q.SetField(field)
+	q.SetBoost(boost)
+	return q
+}
+
+// hasSearchableTerms returns true if text has any terms left after it is
+// analyzed, which removes common words like "the".
+func hasSearchableTerms(text string) bool {
+	tokens, err := indexMapping.AnalyzeText(standard.Name, []byte(text))
+	return err != nil || len(tokens) > 0
+}
+
+// parseRange splits value into the two ends of a range "a..b". Both ends are
+// the same if value is not a range, and an end is empty if it is left out.
+func parseRange(value token) (start, end string, err error) {
+	if value.kind != tokenWord {
+		return "", "", &SyntaxError{value.offset, fmt.Sprintf(l("expected a value or range, got %v"), value)}
+	}
+	start, end, isRange := strings.Cut(value.text, "..")
+	if !isRange {
+		return value.text, value.text, nil
+	}
+	if start == "" && end == "" {
+		return "", "", &SyntaxError{value.offset, l("range needs a start or an end")}
+	}
+	return start, end, nil
+}
+
+func newNumQuery(value token) (query.Query, error) {
+	start, end, err := parseRange(value)
+	if err != nil {
+		return nil, err
+	}
+
+	parse := func(s string, offset int, missing int) (int, error) {
+		if s == "" {
+			return missing, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, &SyntaxError{offset, fmt.Sprintf(l("%q is not a comic number"), s)}
+		}
+		return n, nil
+	}
+	first, err := parse(start, value.offset, 0)
+	if err != nil {
+		return nil, err
+	}
+	last, err := parse(end, value.offset+utf8.RuneCountInString(value.text)-utf8.RuneCountInString(end), math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+	if first > last {
+		return nil, &SyntaxError{value.offset, fmt.Sprintf(l("range %q ends before it starts"), value.text)}
+	}
+	return newNumRangeQuery(first, last), nil
+}
+
+// newNumRangeQuery returns a query that matches comics numbered first to last.
+func newNumRangeQuery(first, last int) *query.NumericRangeQuery {
+	min, max := float64(first), float64(last)
+	inclusive := true
+	q := query.NewNumericRangeInclusiveQuery(&min, &max, &inclusive, &inclusive)
+	q.SetField(fieldNum)
+	return q
+}
+
+func newYearQuery(value token) (query.Query, error) {
+	start, end, err := parseRange(value)
+	if err != nil {
+		return nil, err
+	}
+
+	parse := func(s string, offset int) (time.Time, error) {
+		if s == "" {
+			return time.Time{}, nil
+		}
+		year, err := strconv.Atoi(s)
+		if err != nil || year < minYear || year > maxYear {
+			return time.Time{}, &SyntaxError{offset, fmt.Sprintf(l("%q is not a year"), s)}
+		}
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	from, err := parse(start, value.offset)
+	if err != nil {
+		return nil, err
+	}
+	until, err := parse(end, value.offset+utf8.RuneCountInString(value.text)-utf8.RuneCountInString(end))
+	if err != nil {
+		return nil, err
+	}
+	if !until.IsZero() {
+		until = until.AddDate(1, 0, 0)
+	}
+	return newDateRangeQuery(value, from, until)
+}
+
+func newDateQuery(value token) (query.Query, error) {
+	start, end, err := parseRange(value)
+	if err != nil {
+		return nil, err
+	}
+
+	parse := func(s string, offset int) (time.Time, error) {
+		if s == "" {
+			return time.Time{}, nil
+		}
+		date, err := time.Parse(dateLayout, s)
+		if err != nil || date.Year() < minYear || date.Year() > maxYear {
+			return time.Time{}, &SyntaxError{offset, fmt.Sprintf(l("%q is not a date like 2006-01-02"), s)}
+		}
+		return date, nil
+	}
+	from, err := parse(start, value.offset)
+	if err != nil {
+		return nil, err
+	}
+	until, err := parse(end, value.offset+utf8.RuneCountInString(value.text)-utf8.RuneCountInString(end))
+	if err != nil {
+		return nil, err
+	}
+	if !until.IsZero() {
+		until = until.AddDate(0, 0, 1)
+	}
+	return newDateRangeQuery(value, from, until)
+}
+
+// newDateRangeQuery returns a query that matches comics published from the
+// start of from until just before until. A zero time leaves that end open.
+func newDateRangeQuery(value token, from, until time.Time) (query.Query, error) {
+	if !from.IsZero() && !until.IsZero() && !from.Before(until) {
+		return nil, &SyntaxError{value.offset, fmt.Sprintf(l("range %q ends before it starts"), value.text)}
+	}
+	inclusive, exclusive := true, false
+	q := query.NewDateRangeInclusiveQuery(from, until, &inclusive, &exclusive)
+	q.SetField(fieldDate)
+	return q, nil
+}
@@ -0,0 +1,268 @@
+package search_test
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/rkoesters/xkcd"
+	"github.com/rkoesters/xkcd-gtk/internal/search"
+)
+
+var queryTestComics = []*xkcd.Comic{
+	{Num: 327, Title: "Exploits of a Mom", SafeTitle: "Exploits of a Mom", Alt: "Her daughter is named Help I'm trapped in a driver's license factory.", Transcript: "Did you really name your son Robert'); DROP TABLE Students;--?", Year: "2007", Month: "10", Day: "10"},
+	{Num: 1000, Title: "1000 Comics", SafeTitle: "1000 Comics", Alt: "Thank you for making me feel less alone.", Year: "2012", Month: "1", Day: "6"},
+	{Num: 1050, Title: "Forgot Algebra", SafeTitle: "Forgot Algebra", Alt: "The physics teacher is running late.", Year: "2012", Month: "4", Day: "13"},
+	{Num: 1200, Title: "Authorization", SafeTitle: "Authorization", Alt: "Physics is hard.", Transcript: "Megan logs in.", Year: "2013", Month: "4", Day: "26"},
+}
+
+func newQueryTestIndex(t *testing.T) *search.Index {
+	t.Helper()
+	si, err := search.New(filepath.Join(t.TempDir(), "search"))
+	if err != nil {
+		t.Fatal("error creating test search index: ", err)
+	}
+	t.Cleanup(func() { si.Close() })
+	for _, comic := range queryTestComics {
+		err = si.Index(comic)
+		if err != nil {
+			t.Fatal("error indexing comic: ", err)
+		}
+	}
+	return si
+}
+
+func TestSearchQuery(t *testing.T) {
+	si := newQueryTestIndex(t)
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"physics", []int{1050, 1200}},
+		{"physics year:2012", []int{1050}},
+		{"physics AND year:2013", []int{1200}},
+		{"year:2012..", []int{1000, 1050, 1200}},
+		{"year:..2012", []int{327, 1000, 1050}},
+		{"num:1000..1100", []int{1000, 1050}},
+		{"num:..999", []int{327}},
+		{"num:1200", []int{1200}},
+		{"date:2012-01-06", []int{1000}},
+		{"date:2012-01-07..2012-12-31", []int{1050}},
+		{"title:algebra OR alt:alone", []int{1000, 1050}},
+		{"physics -transcript:megan", []int{1050}},
+		{"physics NOT transcript:megan", []int{1050}},
+		{"NOT physics", []int{327, 1000}},
+		{`"drop table"`, []int{327}},
+		{`transcript:"drop table"`, []int{327}},
+		{`alt:"drop table"`, nil},
+		{"(algebra OR authorization) year:2013", []int{1200}},
+		{"runs", []int{1050}},
+		{"the", nil},
+		{"the physics", []int{1050, 1200}},
+		// Only the known filters are filters.
+		{"Physics: hard", []int{1200}},
+		{"author:megan", nil},
+	}
+	for _, test := range tests {
+		results, err := si.Search(test.query, 0, testSearchLimit, search.SortRelevance)
+		if err != nil {
+			t.Errorf("error searching for %q: %v", test.query, err)
+			continue
+		}
+		var got []int
+		for _, hit := range results.Hits {
+			n, err := strconv.Atoi(hit.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, n)
+		}
+		sort.Ints(got)
+		if !equalInts(got, test.want) {
+			t.Errorf("search for %q: expected %v, got %v", test.query, test.want, got)
+		}
+	}
+}
+
+func TestSearchQueryNumberFirst(t *testing.T) {
+	si := newQueryTestIndex(t)
+
+	results, err := si.Search("1000", 0, testSearchLimit, search.SortRelevance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Hits) == 0 || results.Hits[0].ID != "1000" {
+		t.Errorf("expected comic 1000 first, got %v", results.Hits)
+	}
+}
+
+func TestSearchQuerySyntaxError(t *testing.T) {
+	si := newQueryTestIndex(t)
+
+	tests := []struct {
+		query  string
+		offset int
+	}{
+		{`"drop table`, 0},
+		{"(physics", 0},
+		{"physics)", 7},
+		{"physics OR", 10},
+		{"AND physics", 0},
+		{"title:", 6},
+		{"num:abc", 4},
+		{"num:10..x", 8},
+		{"num:20..10", 4},
+		{"num:..", 4},
+		{"year:12", 5},
+		{"date:2012-13-01", 5},
+		{"date:2012-02-01..2012-01-01", 5},
+		{`num:"1000"`, 4},
+	}
+	for _, test := range tests {
+		_, err := si.Search(test.query, 0, testSearchLimit, search.SortRelevance)
+		var syntaxErr *search.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("search for %q: expected syntax error, got %v", test.query, err)
+			continue
+		}
+		if syntaxErr.Offset != test.offset {
+			t.Errorf("search for %q: expected error at %v, got %v", test.query, test.offset, syntaxErr)
+		}
+	}
+}
+
+func TestSearchPagination(t *testing.T) {
+	si := newQueryTestIndex(t)
+
+	tests := []struct {
+		order search.SortOrder
+		want  []int
+	}{
+		{search.SortNewest, []int{1200, 1050, 1000, 327}},
+		{search.SortOldest, []int{327, 1000, 1050, 1200}},
+		{search.SortNumber, []int{327, 1000, 1050, 1200}},
+	}
+	for _, test := range tests {
+		var got []int
+		for offset := 0; offset < len(queryTestComics)+2; offset += 2 {
+			results, err := si.Search("year:2000..", offset, 2, test.order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results.Total != uint64(len(queryTestComics)) {
+				t.Errorf("expected total of %v, got %v", len(queryTestComics), results.Total)
+			}
+			if len(results.Hits) > 2 {
+				t.Errorf("expected at most 2 results, got %v", len(results.Hits))
+			}
+			for _, hit := range results.Hits {
+				n, err := strconv.Atoi(hit.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, n)
+			}
+		}
+		if !equalInts(got, test.want) {
+			t.Errorf("sort order %v: expected %v, got %v", test.order, test.want, got)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSnippet(t *testing.T) {
+	si := newQueryTestIndex(t)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"physics teacher", "The <mark>physics</mark> <mark>teacher</mark> is running late."},
+		{"transcript:students", "Did you really name your son Robert&#39;); DROP TABLE <mark>Students</mark>;--?"},
+		{"algebra", ""},
+	}
+	for _, test := range tests {
+		results, err := si.Search(test.query, 0, testSearchLimit, search.SortRelevance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results.Hits) == 0 {
+			t.Errorf("search for %q: expected results", test.query)
+			continue
+		}
+		got := search.Snippet(results.Hits[0])
+		if got != test.want {
+			t.Errorf("search for %q: expected snippet %q, got %q", test.query, test.want, got)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	si := newQueryTestIndex(t)
+
+	got, err := si.Suggest("Ph", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "physics" {
+		t.Errorf("expected suggestion physics, got %v", got)
+	}
+
+	// Words are suggested without stemming, most common first.
+	got, err = si.Suggest("a", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "algebra" {
+		t.Errorf("expected 2 suggestions starting with algebra, got %v", got)
+	}
+
+	got, err = si.Suggest("physics", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected no suggestions for a whole word, got %v", got)
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	si := newQueryTestIndex(t)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"phyiscs", "physics"},
+		{"phisycs year:2012", "physics year:2012"},
+		{"title:algebar OR num:1000", "title:algebra OR num:1000"},
+		{"physics", ""},
+		{"the", ""},
+		{"1001", ""},
+		{"zzzzzzzz", ""},
+		{`"unterminated`, ""},
+	}
+	for _, test := range tests {
+		got, err := si.DidYouMean(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("did you mean for %q: expected %q, got %q", test.query, test.want, got)
+		}
+	}
+}
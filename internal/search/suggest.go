@@ -0,0 +1,170 @@
+package search
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// Suggest returns up to limit words from the titles, alt texts and transcripts
+// of the indexed comics that start with prefix, most common first.
+func (i *Index) Suggest(prefix string, limit int) ([]string, error) {
+	// Indexed words are lower case.
+	prefix = strings.ToLower(prefix)
+	if prefix == "" || limit <= 0 {
+		return nil, nil
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	dict, err := i.index.FieldDictPrefix(fieldWords, []byte(prefix))
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readDict(dict)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].Count > entries[b].Count
+	})
+	var words []string
+	for _, e := range entries {
+		if len(words) == limit {
+			break
+		}
+		if e.Term != prefix {
+			words = append(words, e.Term)
+		}
+	}
+	return words, nil
+}
+
+// DidYouMean returns userQuery with the words that are not in any indexed comic
+// replaced by similar words that are, or "" if there is nothing to correct.
+func (i *Index) DidYouMean(userQuery string) (string, error) {
+	tokens, err := lex(userQuery)
+	if err != nil {
+		// Malformed queries get a SyntaxError from Search instead.
+		return "", nil
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	advanced, err := i.index.Advanced()
+	if err != nil {
+		return "", err
+	}
+	reader, err := advanced.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	fuzzy, ok := reader.(index.IndexReaderFuzzy)
+	if !ok {
+		return "", nil
+	}
+
+	runes := []rune(userQuery)
+	var b strings.Builder
+	last := 0
+	changed := false
+	for k, t := range tokens {
+		if t.kind != tokenWord {
+			continue
+		}
+		if k > 0 && tokens[k-1].kind == tokenFilter && filterTextFields[tokens[k-1].text] == nil {
+			// Numbers and dates are not words.
+			continue
+		}
+		correction, err := i.correctWord(fuzzy, t.text)
+		if err != nil {
+			return "", err
+		}
+		if correction == "" {
+			continue
+		}
+		b.WriteString(string(runes[last:t.offset]))
+		b.WriteString(correction)
+		last = t.offset + len([]rune(t.text))
+		changed = true
+	}
+	if !changed {
+		return "", nil
+	}
+	b.WriteString(string(runes[last:]))
+	return b.String(), nil
+}
+
+// correctWord returns the most common indexed word that is similar to word, or
+// "" if word is indexed, too common to search for, or has no similar words.
+func (i *Index) correctWord(fuzzy index.IndexReaderFuzzy, word string) (string, error) {
+	if _, err := strconv.Atoi(word); err == nil {
+		// Comic numbers are searched for too.
+		return "", nil
+	}
+	tokens, err := indexMapping.AnalyzeText(standard.Name, []byte(word))
+	if err != nil || len(tokens) != 1 {
+		return "", err
+	}
+	term := string(tokens[0].Term)
+
+	dict, err := i.index.FieldDictRange(fieldWords, []byte(term), []byte(term))
+	if err != nil {
+		return "", err
+	}
+	entries, err := readDict(dict)
+	if err != nil || len(entries) > 0 {
+		return "", err
+	}
+
+	// Short words are similar to too many other words to allow more than one
+	// typo.
+	maxFuzziness := 1
+	if len(term) >= 5 {
+		maxFuzziness = 2
+	}
+	for fuzziness := 1; fuzziness <= maxFuzziness; fuzziness++ {
+		dict, err := fuzzy.FieldDictFuzzy(fieldWords, term, fuzziness, "")
+		if err != nil {
+			return "", err
+		}
+		entries, err := readDict(dict)
+		if err != nil {
+			return "", err
+		}
+		var best *index.DictEntry
+		for k := range entries {
+			if best == nil || entries[k].Count > best.Count {
+				best = &entries[k]
+			}
+		}
+		if best != nil {
+			return best.Term, nil
+		}
+	}
+	return "", nil
+}
+
+// readDict reads every entry of dict, then closes it.
+func readDict(dict index.FieldDict) ([]index.DictEntry, error) {
+	defer dict.Close()
+
+	var entries []index.DictEntry
+	for {
+		e, err := dict.Next()
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			return entries, nil
+		}
+		entries = append(entries, *e)
+	}
+}
@@ -10,6 +10,13 @@ import (
 // Application is a struct that holds our application's settings.
 type Application struct {
 	DarkMode bool
+
+	// ImageCacheQuota is the maximum size of the comic image cache in bytes.
+	// Zero means unlimited.
+	ImageCacheQuota int64 `json:",omitempty"`
+
+	// Offline is true if the user asked the app not to use the network.
+	Offline bool `json:",omitempty"`
 }
 
 var (
@@ -19,6 +26,8 @@ var (
 
 func (a *Application) loadDefaults() {
 	a.DarkMode = false
+	a.ImageCacheQuota = 0
+	a.Offline = false
 }
 
 // ReadFrom takes the given io.Reader and tries to parse json encoded state from
@@ -8,4 +8,5 @@ const (
 	PaddingPopoverCompact    = 8
 	PaddingAuxiliaryWindow   = 12
 	PaddingUnlinkedButtonBox = 4
+	PaddingComicPlaceholder  = 12
 )
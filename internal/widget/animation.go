@@ -0,0 +1,127 @@
+package widget
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/draw"
+	"image/gif"
+	"os"
+	"time"
+
+	"github.com/gotk3/gotk3/gdk"
+)
+
+// animation is an image with multiple frames, such as an animated GIF.
+type animation struct {
+	frames []*gdk.Pixbuf
+	// delays[i] is how long frames[i] should be shown.
+	delays []time.Duration
+}
+
+// defaultFrameDelay is used for frames that do not specify a usable delay,
+// matching what web browsers do.
+const defaultFrameDelay = 100 * time.Millisecond
+
+// loadAnimation loads the image at path as an animation. Returns nil if the
+// image is not an animated GIF with more than one frame.
+func loadAnimation(path string) (*animation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(4)
+	if err != nil || !bytes.Equal(magic, []byte("GIF8")) {
+		return nil, nil
+	}
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Image) < 2 {
+		return nil, nil
+	}
+
+	a := &animation{}
+	for i, frame := range composeGIFFrames(g) {
+		pixbuf, err := pixbufFromRGBA(frame)
+		if err != nil {
+			return nil, err
+		}
+		a.frames = append(a.frames, pixbuf)
+		a.delays = append(a.delays, gifFrameDelay(g.Delay[i]))
+	}
+	return a, nil
+}
+
+// composeGIFFrames returns the full picture shown for each frame of g. GIF
+// frames only store the part of the picture that changed, and say how to
+// dispose of themselves before the next frame is drawn.
+func composeGIFFrames(g *gif.GIF) []*image.RGBA {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(bounds)
+
+	frames := make([]*image.RGBA, 0, len(g.Image))
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames = append(frames, cloneRGBA(canvas))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	clone := image.NewRGBA(img.Bounds())
+	copy(clone.Pix, img.Pix)
+	return clone
+}
+
+// gifFrameDelay converts a GIF frame delay, in hundredths of a second, to a
+// time.Duration.
+func gifFrameDelay(centiseconds int) time.Duration {
+	if centiseconds <= 1 {
+		return defaultFrameDelay
+	}
+	return time.Duration(centiseconds) * 10 * time.Millisecond
+}
+
+// pixbufFromRGBA copies img into a new gdk.Pixbuf. GIF pixels are either fully
+// opaque or fully transparent, so the premultiplied alpha of image.RGBA does
+// not need to be undone.
+func pixbufFromRGBA(img *image.RGBA) (*gdk.Pixbuf, error) {
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	pixbuf, err := gdk.PixbufNew(gdk.COLORSPACE_RGB, true, 8, width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	pixels := pixbuf.GetPixels()
+	rowstride := pixbuf.GetRowstride()
+	for y := 0; y < height; y++ {
+		copy(pixels[y*rowstride:y*rowstride+width*4], img.Pix[y*img.Stride:y*img.Stride+width*4])
+	}
+	return pixbuf, nil
+}
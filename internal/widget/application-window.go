@@ -1,6 +1,7 @@
 package widget
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -30,10 +31,14 @@ type ApplicationWindow struct {
 	comicMutex sync.RWMutex
 
 	bookmarksObserverID int
+	comicObserverID     int
+	connectivityID      int
+	progressObserverID  int
 
 	actions map[string]*glib.SimpleAction
 
 	header        *gtk.HeaderBar
+	offlineIcon   *gtk.Image
 	navigationBar *NavigationBar
 	searchMenu    *SearchMenu
 	bookmarksMenu *BookmarksMenu
@@ -77,6 +82,7 @@ func NewApplicationWindow(app Application) (*ApplicationWindow, error) {
 	registerAction("first-comic", win.FirstComic)
 	registerAction("newest-comic", win.NewestComic)
 	registerAction("next-comic", win.NextComic)
+	registerAction("open-in-browser", win.OpenInBrowser)
 	registerAction("open-link", win.OpenLink)
 	registerAction("previous-comic", win.PreviousComic)
 	registerAction("random-comic", win.RandomComic)
@@ -117,6 +123,10 @@ func NewApplicationWindow(app Application) (*ApplicationWindow, error) {
 	win.registerBookmarkObserver()
 	win.Connect("delete-event", win.unregisterBookmarkObserver)
 
+	// Show corrections to the current comic's metadata as they arrive.
+	win.registerComicObserver()
+	win.Connect("delete-event", win.unregisterComicObserver)
+
 	// If the window is closed, we want to write our state to disk.
 	win.Connect("delete-event", func() {
 		win.state.SaveState(win, win.properties)
@@ -157,8 +167,16 @@ func NewApplicationWindow(app Application) (*ApplicationWindow, error) {
 	}
 	win.header.PackStart(win.navigationBar)
 
+	// Create the indicator shown while we can only show cached comics.
+	win.offlineIcon, err = gtk.ImageNewFromIconName("network-offline-symbolic", gtk.ICON_SIZE_SMALL_TOOLBAR)
+	if err != nil {
+		return nil, err
+	}
+	win.offlineIcon.SetNoShowAll(true)
+	win.header.PackStart(win.offlineIcon)
+
 	// Create the window menu.
-	win.windowMenu, err = NewWindowMenu(accels, app.PrefersAppMenu(), app.DarkMode, app.SetDarkMode)
+	win.windowMenu, err = NewWindowMenu(accels, app.PrefersAppMenu(), app.DarkMode, app.SetDarkMode, app.Offline, app.SetOffline)
 	if err != nil {
 		return nil, err
 	}
@@ -166,7 +184,7 @@ func NewApplicationWindow(app Application) (*ApplicationWindow, error) {
 	win.header.PackEnd(win.windowMenu)
 
 	// Create the search menu.
-	win.searchMenu, err = NewSearchMenu(accels, win.SetComic, app.SearchIndex().Search)
+	win.searchMenu, err = NewSearchMenu(accels, win.SetComic, app.SearchIndex().Search, app.SearchIndex().Suggest, app.SearchIndex().DidYouMean)
 	if err != nil {
 		return nil, err
 	}
@@ -181,6 +199,15 @@ func NewApplicationWindow(app Application) (*ApplicationWindow, error) {
 
 	win.header.ShowAll()
 	win.SetTitlebar(win.header)
+	win.SyncConnectivity(cache.ServingCachedOnly())
+
+	// Keep the offline indicator up to date.
+	win.registerConnectivityObserver()
+	win.Connect("delete-event", win.unregisterConnectivityObserver)
+
+	// Show whether the search index is being updated.
+	win.registerProgressObserver()
+	win.Connect("delete-event", win.unregisterProgressObserver)
 
 	win.SetComic(win.state.ComicNumber)
 
@@ -352,6 +379,9 @@ func (win *ApplicationWindow) SetComic(n int) {
 	go func() {
 		var err error
 
+		// Once the comic is ready, get its neighbours ready too.
+		defer cache.Prefetch(n)
+
 		// Add the DisplayComic function to the event loop so our UI gets
 		// updated with the new comic.
 		defer glib.IdleAddPriority(glib.PRIORITY_DEFAULT, win.DisplayComic)
@@ -360,6 +390,9 @@ func (win *ApplicationWindow) SetComic(n int) {
 		win.comicMutex.Lock()
 		defer win.comicMutex.Unlock()
 
+		// Viewed images are the last to be evicted from the image cache.
+		defer cache.MarkComicImageViewed(n)
+
 		win.comic, err = cache.ComicInfo(n)
 		if err != nil {
 			log.Print("error downloading comic info: ", n)
@@ -375,7 +408,11 @@ func (win *ApplicationWindow) SetComic(n int) {
 			return
 		}
 
-		err = cache.DownloadComicImage(n, win.app.CacheWindowVR)
+		err = cache.DownloadComicImage(n)
+		if errors.Is(err, cache.ErrNoComicImage) {
+			// The image viewer explains why there is no image.
+			return
+		}
 		if err != nil {
 			log.Print("error downloading comic image: ", err)
 			// We can be sneaky if we get an error, we use SafeTitle for window
@@ -448,6 +485,11 @@ func (win *ApplicationWindow) Explain() {
 	win.app.OpenURL(fmt.Sprintf("https://www.explainxkcd.com/%v/#Explanation", win.comicNumber()))
 }
 
+// OpenInBrowser opens the comic's page on xkcd.com in the user's web browser.
+func (win *ApplicationWindow) OpenInBrowser() {
+	win.app.OpenURL(fmt.Sprintf("https://xkcd.com/%v/", win.comicNumber()))
+}
+
 // OpenLink opens the comic's Link in the user's web browser.
 func (win *ApplicationWindow) OpenLink() {
 	win.comicMutex.RLock()
@@ -486,6 +528,85 @@ func (win *ApplicationWindow) unregisterBookmarkObserver() {
 	win.app.BookmarksList().RemoveObserver(win.bookmarksObserverID)
 }
 
+func (win *ApplicationWindow) registerComicObserver() {
+	ch := make(chan int)
+
+	win.comicObserverID = cache.AddComicObserver(ch)
+
+	go func() {
+		for n := range ch {
+			glib.IdleAdd(func() {
+				// Reload the comic so that the new metadata (and image, if
+				// it changed) is displayed.
+				if n == win.comicNumber() {
+					win.SetComic(n)
+				}
+			})
+		}
+	}()
+}
+
+func (win *ApplicationWindow) unregisterComicObserver() {
+	cache.RemoveComicObserver(win.comicObserverID)
+}
+
+func (win *ApplicationWindow) registerConnectivityObserver() {
+	ch := make(chan bool)
+
+	win.connectivityID = cache.AddConnectivityObserver(ch)
+
+	go func() {
+		for cachedOnly := range ch {
+			glib.IdleAdd(func() {
+				win.SyncConnectivity(cachedOnly)
+			})
+		}
+	}()
+}
+
+func (win *ApplicationWindow) unregisterConnectivityObserver() {
+	cache.RemoveConnectivityObserver(win.connectivityID)
+}
+
+func (win *ApplicationWindow) registerProgressObserver() {
+	ch := make(chan cache.ProgressEvent, cache.ProgressObserverBufferSize)
+
+	win.progressObserverID = cache.AddProgressObserver(ch)
+
+	go func() {
+		for e := range ch {
+			if !updatesSearchIndex(e.Operation) {
+				continue
+			}
+			glib.IdleAdd(func() {
+				win.searchMenu.HandleProgress(e)
+			})
+		}
+	}()
+}
+
+func (win *ApplicationWindow) unregisterProgressObserver() {
+	cache.RemoveProgressObserver(win.progressObserverID)
+}
+
+// SyncConnectivity updates the offline indicator and the offline mode toggle.
+// cachedOnly should be true if we can only show comics that are in the cache.
+func (win *ApplicationWindow) SyncConnectivity(cachedOnly bool) {
+	if win.offlineIcon == nil {
+		return
+	}
+
+	offline := win.app.Offline()
+	win.windowMenu.offlineButton.SyncState(offline)
+
+	if offline {
+		win.offlineIcon.SetTooltipText(l("Offline mode is on, showing cached comics only"))
+	} else {
+		win.offlineIcon.SetTooltipText(l("Can't reach xkcd.com, showing cached comics only"))
+	}
+	win.offlineIcon.SetVisible(cachedOnly)
+}
+
 // IsBookmarked returns whether the current comic is bookmarked. Do not call
 // while holding a write lock on win.comicMutex.
 func (win *ApplicationWindow) IsBookmarked() bool {
@@ -521,6 +642,7 @@ func (win *ApplicationWindow) Dispose() {
 	win.comic = nil
 	win.actions = nil
 	win.header = nil
+	win.offlineIcon = nil
 	win.navigationBar.Dispose()
 	win.navigationBar = nil
 	win.searchMenu.Dispose()
@@ -4,7 +4,6 @@ import (
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 	"github.com/rkoesters/xkcd-gtk/internal/bookmarks"
-	"github.com/rkoesters/xkcd-gtk/internal/cache"
 	"github.com/rkoesters/xkcd-gtk/internal/search"
 )
 
@@ -17,15 +16,17 @@ func AppName() string { return l("Comic Sticks") }
 type Application interface {
 	AddWindow(gtk.IWindow)
 	BookmarksList() *bookmarks.List
-	CacheWindowVR() cache.ViewRefresher
-	CacheWindowVRW() cache.ViewRefreshWither
 	ConnectDarkModeChanged(f any) glib.SignalHandle
 	DarkMode() bool
 	GtkApplication() *gtk.Application
 	GtkTheme() (string, error)
+	ImageCacheQuota() int64
+	Offline() bool
 	OpenURL(string) error
 	PrefersAppMenu() bool
 	RemoveWindow(gtk.IWindow)
 	SearchIndex() *search.Index
 	SetDarkMode(bool)
+	SetImageCacheQuota(int64)
+	SetOffline(bool)
 }
@@ -1,6 +1,10 @@
 package widget
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -17,15 +21,41 @@ type CacheWindow struct {
 
 	actions map[string]*glib.SimpleAction
 
-	box                     *gtk.Box
-	metadataLevelBar        *labeledLevelBar
-	imageLevelBar           *labeledLevelBar
-	downloadAllImagesButton *gtk.Button
+	progressObserverID int
+
+	box                      *gtk.Box
+	metadataLevelBar         *labeledLevelBar
+	imageLevelBar            *labeledLevelBar
+	searchIndexSize          *gtk.Label
+	rebuildSearchIndexButton *gtk.Button
+	imageQuota               *gtk.SpinButton
+	applyImageQuotaButton    *gtk.Button
+	status                   *gtk.Label
+	comicsExpander           *gtk.Expander
+	cachedComics             *CachedComicsView
+	deleteComicsButton       *gtk.Button
+	refreshComicsButton      *gtk.Button
+	downloadAllImagesButton  *gtk.Button
+	verifyImagesButton       *gtk.Button
+	stopTaskButton           *gtk.Button
+	exportLibraryButton      *gtk.Button
+	importLibraryButton      *gtk.Button
+
+	// cancelTask stops the ongoing background task started by runTask. May be
+	// nil.
+	cancelTask      context.CancelFunc
+	cancelTaskMutex sync.Mutex
+	// taskDescription describes the ongoing background task started by
+	// runTask, or is empty if there is none. Only used in the UI event loop.
+	taskDescription string
 
 	lastRefreshMetadata      time.Time
 	lastRefreshMetadataMutex sync.RWMutex
 	lastRefreshImages        time.Time
 	lastRefreshImagesMutex   sync.RWMutex
+	// lastRefreshComics is when RefreshComics last started. Only used in the
+	// UI event loop.
+	lastRefreshComics time.Time
 }
 
 var _ Widget = &CacheWindow{}
@@ -39,15 +69,22 @@ func NewCacheWindow(app Application) (*CacheWindow, error) {
 	super.SetSizeRequest(400, -1)
 	super.SetResizable(false)
 	super.HideOnDelete()
-	super.Connect("hide", func(win gtk.IWindow) {
-		app.RemoveWindow(win)
-	})
 
 	cw := &CacheWindow{
 		ApplicationWindow: super,
 		actions:           make(map[string]*glib.SimpleAction),
 	}
 
+	super.Connect("hide", func(win gtk.IWindow) {
+		// Tasks started from this window should not outlive it.
+		cw.StopTask()
+		app.RemoveWindow(win)
+	})
+
+	// Follow the progress of cache operations, whoever started them.
+	cw.registerProgressObserver()
+	cw.Connect("destroy", cw.unregisterProgressObserver)
+
 	cw.Connect("destroy", cw.Dispose)
 
 	// Initialize our window accelerators.
@@ -81,6 +118,119 @@ func NewCacheWindow(app Application) (*CacheWindow, error) {
 	cw.imageLevelBar.SetMarginTop(style.PaddingAuxiliaryWindow)
 	cw.box.PackStart(cw.imageLevelBar, false, true, 0)
 
+	cw.searchIndexSize, err = gtk.LabelNew("")
+	if err != nil {
+		return nil, err
+	}
+	cw.searchIndexSize.SetXAlign(0)
+
+	searchIndexBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, style.PaddingAuxiliaryWindow)
+	if err != nil {
+		return nil, err
+	}
+	searchIndexBox.SetMarginTop(style.PaddingAuxiliaryWindow)
+	searchIndexBox.PackStart(cw.searchIndexSize, true, true, 0)
+	cw.box.PackStart(searchIndexBox, false, true, 0)
+
+	cw.rebuildSearchIndexButton, err = gtk.ButtonNewWithLabel(l("Rebuild search index"))
+	if err != nil {
+		return nil, err
+	}
+	cw.rebuildSearchIndexButton.SetActionName("win.rebuild-search-index")
+	searchIndexBox.PackEnd(cw.rebuildSearchIndexButton, false, false, 0)
+
+	quotaBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, style.PaddingAuxiliaryWindow)
+	if err != nil {
+		return nil, err
+	}
+	quotaBox.SetMarginTop(style.PaddingAuxiliaryWindow)
+	cw.box.PackStart(quotaBox, false, true, 0)
+
+	quotaLabel, err := gtk.LabelNew(l("Image cache limit in MB (0 for no limit)"))
+	if err != nil {
+		return nil, err
+	}
+	quotaLabel.SetXAlign(0)
+	quotaBox.PackStart(quotaLabel, true, true, 0)
+
+	cw.imageQuota, err = gtk.SpinButtonNewWithRange(0, 100000, 10)
+	if err != nil {
+		return nil, err
+	}
+	cw.imageQuota.SetValue(float64(app.ImageCacheQuota() / bytesPerMegabyte))
+	cw.imageQuota.Connect("activate", func() {
+		cw.actions["apply-image-quota"].Activate(nil)
+	})
+
+	cw.applyImageQuotaButton, err = gtk.ButtonNewWithLabel(l("Apply"))
+	if err != nil {
+		return nil, err
+	}
+	cw.applyImageQuotaButton.SetActionName("win.apply-image-quota")
+	quotaBox.PackEnd(cw.applyImageQuotaButton, false, true, 0)
+	quotaBox.PackEnd(cw.imageQuota, false, true, 0)
+
+	cw.status, err = gtk.LabelNew("")
+	if err != nil {
+		return nil, err
+	}
+	cw.status.SetXAlign(0)
+	cw.status.SetLineWrap(true)
+	cw.status.SetMarginTop(style.PaddingAuxiliaryWindow)
+	cw.box.PackStart(cw.status, false, true, 0)
+
+	cw.comicsExpander, err = gtk.ExpanderNew(l("Cached comics"))
+	if err != nil {
+		return nil, err
+	}
+	cw.comicsExpander.SetMarginTop(style.PaddingAuxiliaryWindow)
+	cw.comicsExpander.Connect("notify::expanded", cw.RefreshComics)
+	cw.box.PackStart(cw.comicsExpander, true, true, 0)
+
+	comicsBox, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0)
+	if err != nil {
+		return nil, err
+	}
+	cw.comicsExpander.Add(comicsBox)
+
+	comicsScroller, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	comicsScroller.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	comicsScroller.SetMinContentHeight(250)
+	comicsScroller.SetShadowType(gtk.SHADOW_IN)
+	comicsScroller.SetMarginTop(style.PaddingAuxiliaryWindow)
+	comicsBox.PackStart(comicsScroller, true, true, 0)
+
+	cw.cachedComics, err = NewCachedComicsView()
+	if err != nil {
+		return nil, err
+	}
+	comicsScroller.Add(cw.cachedComics)
+
+	comicsBB, err := gtk.ButtonBoxNew(gtk.ORIENTATION_HORIZONTAL)
+	if err != nil {
+		return nil, err
+	}
+	comicsBB.SetHAlign(gtk.ALIGN_END)
+	comicsBB.SetMarginTop(style.PaddingAuxiliaryWindow)
+	comicsBox.PackStart(comicsBB, false, true, 0)
+
+	cw.deleteComicsButton, err = gtk.ButtonNewWithLabel(l("Delete"))
+	if err != nil {
+		return nil, err
+	}
+	cw.deleteComicsButton.SetActionName("win.delete-comics")
+	comicsBB.PackStart(cw.deleteComicsButton, false, true, 0)
+
+	cw.refreshComicsButton, err = gtk.ButtonNewWithLabel(l("Download again"))
+	if err != nil {
+		return nil, err
+	}
+	cw.refreshComicsButton.SetActionName("win.refresh-comics")
+	comicsBB.PackStart(cw.refreshComicsButton, false, true, 0)
+
 	bb, err := gtk.ButtonBoxNew(gtk.ORIENTATION_HORIZONTAL)
 	if err != nil {
 		return nil, err
@@ -89,6 +239,28 @@ func NewCacheWindow(app Application) (*CacheWindow, error) {
 	bb.SetMarginTop(style.PaddingAuxiliaryWindow)
 	cw.box.PackEnd(bb, false, true, 0)
 
+	libraryBB, err := gtk.ButtonBoxNew(gtk.ORIENTATION_HORIZONTAL)
+	if err != nil {
+		return nil, err
+	}
+	libraryBB.SetHAlign(gtk.ALIGN_END)
+	libraryBB.SetMarginTop(style.PaddingAuxiliaryWindow)
+	cw.box.PackEnd(libraryBB, false, true, 0)
+
+	cw.exportLibraryButton, err = gtk.ButtonNewWithLabel(l("Export library..."))
+	if err != nil {
+		return nil, err
+	}
+	cw.exportLibraryButton.SetActionName("win.export-library")
+	libraryBB.PackStart(cw.exportLibraryButton, false, true, 0)
+
+	cw.importLibraryButton, err = gtk.ButtonNewWithLabel(l("Import library..."))
+	if err != nil {
+		return nil, err
+	}
+	cw.importLibraryButton.SetActionName("win.import-library")
+	libraryBB.PackStart(cw.importLibraryButton, false, true, 0)
+
 	cw.downloadAllImagesButton, err = gtk.ButtonNewWithLabel(l("Download all comic images"))
 	if err != nil {
 		return nil, err
@@ -96,6 +268,20 @@ func NewCacheWindow(app Application) (*CacheWindow, error) {
 	cw.downloadAllImagesButton.SetActionName("win.download-all-images")
 	bb.PackStart(cw.downloadAllImagesButton, false, true, 0)
 
+	cw.verifyImagesButton, err = gtk.ButtonNewWithLabel(l("Verify comic images"))
+	if err != nil {
+		return nil, err
+	}
+	cw.verifyImagesButton.SetActionName("win.verify-images")
+	bb.PackStart(cw.verifyImagesButton, false, true, 0)
+
+	cw.stopTaskButton, err = gtk.ButtonNewWithLabel(l("Stop"))
+	if err != nil {
+		return nil, err
+	}
+	cw.stopTaskButton.SetActionName("win.stop-task")
+	bb.PackStart(cw.stopTaskButton, false, true, 0)
+
 	registerAction := func(name string, fn any) {
 		action := glib.SimpleActionNew(name, nil)
 		action.Connect("activate", fn)
@@ -105,15 +291,150 @@ func NewCacheWindow(app Application) (*CacheWindow, error) {
 	}
 
 	registerAction("download-all-images", func() {
-		cw.actions["download-all-images"].SetEnabled(false)
-		go func() {
-			cache.DownloadAllComicImages(func() cache.ViewRefreshWither { return cw })
-			b := cw.actions["download-all-images"]
+		cw.runTask(l("Downloading comic images..."), func(ctx context.Context) (string, error) {
+			err := cache.DownloadAllComicImagesContext(ctx)
+			if errors.Is(err, cache.ErrImageQuotaReached) {
+				return l("Stopped because the image cache limit was reached"), nil
+			}
+			return "", err
+		})
+	})
+	registerAction("verify-images", func() {
+		cw.runTask(l("Verifying comic images..."), func(ctx context.Context) (string, error) {
+			corrupt, err := cache.VerifyComicImages(ctx)
+			if err != nil {
+				return "", err
+			}
+			if len(corrupt) == 0 {
+				return l("All cached comic images are valid"), nil
+			}
+			return fmt.Sprintf(ln("Downloaded %v corrupt comic image again", "Downloaded %v corrupt comic images again", uint64(len(corrupt))), len(corrupt)), nil
+		})
+	})
+	registerAction("export-library", func() {
+		filename, ok := cw.chooseLibraryFile(gtk.FILE_CHOOSER_ACTION_SAVE, l("Export library"), l("_Export"))
+		if !ok {
+			return
+		}
+
+		// Bookmarks are modified in the UI event loop, so copy them before
+		// leaving it.
+		var bookmarks bytes.Buffer
+		err := app.BookmarksList().Write(&bookmarks)
+		if err != nil {
+			log.Print("error exporting bookmarks: ", err)
+		}
+
+		cw.runTask(l("Exporting library..."), func(ctx context.Context) (string, error) {
+			err := cache.ExportArchive(ctx, filename, &bookmarks)
+			if err != nil {
+				return "", err
+			}
+			return l("Library exported"), nil
+		})
+	})
+	registerAction("import-library", func() {
+		filename, ok := cw.chooseLibraryFile(gtk.FILE_CHOOSER_ACTION_OPEN, l("Import library"), l("_Import"))
+		if !ok {
+			return
+		}
+
+		cw.runTask(l("Importing library..."), func(ctx context.Context) (string, error) {
+			var bookmarks bytes.Buffer
+			stat, err := cache.ImportArchive(ctx, filename, &bookmarks)
+			if err != nil {
+				return "", err
+			}
+
 			glib.IdleAdd(func() {
-				b.SetEnabled(true)
+				err := app.BookmarksList().Read(&bookmarks)
+				if err != nil {
+					log.Print("error importing bookmarks: ", err)
+				}
 			})
-		}()
+			go cw.RefreshMetadata()
+			go cw.RefreshImages()
+			go cw.RefreshSearchIndex()
+			glib.IdleAdd(cw.RefreshComics)
+
+			return fmt.Sprintf(l("Imported %v comics and %v comic images"), stat.Comics, stat.Images), nil
+		})
+	})
+	registerAction("delete-comics", func() {
+		comics := cw.cachedComics.SelectedComics()
+		if len(comics) == 0 {
+			return
+		}
+
+		cw.runTask(l("Deleting comics..."), func(ctx context.Context) (string, error) {
+			var deleted int
+			for _, n := range comics {
+				if ctx.Err() != nil {
+					break
+				}
+				err := cache.DeleteComic(n)
+				if err != nil {
+					return "", err
+				}
+				deleted++
+			}
+			go cw.RefreshMetadata()
+			go cw.RefreshImages()
+			glib.IdleAdd(cw.RefreshComics)
+			return fmt.Sprintf(ln("Deleted %v comic", "Deleted %v comics", uint64(deleted)), deleted), nil
+		})
+	})
+	registerAction("refresh-comics", func() {
+		comics := cw.cachedComics.SelectedComics()
+		if len(comics) == 0 {
+			return
+		}
+
+		cw.runTask(l("Downloading comics again..."), func(ctx context.Context) (string, error) {
+			var failed int
+			for _, n := range comics {
+				if ctx.Err() != nil {
+					break
+				}
+				err := cache.RefreshComic(ctx, n)
+				if err != nil {
+					log.Printf("error downloading comic %v again: %v", n, err)
+					failed++
+				}
+			}
+			go cw.RefreshImages()
+			glib.IdleAdd(cw.RefreshComics)
+			if failed > 0 {
+				return fmt.Sprintf(ln("Could not download %v of %v comic", "Could not download %v of %v comics", uint64(len(comics))), failed, len(comics)), nil
+			}
+			return fmt.Sprintf(ln("Downloaded %v comic again", "Downloaded %v comics again", uint64(len(comics))), len(comics)), nil
+		})
+	})
+	registerAction("rebuild-search-index", func() {
+		cw.runTask(l("Rebuilding search index..."), func(ctx context.Context) (string, error) {
+			err := app.SearchIndex().Rebuild()
+			if err != nil {
+				return "", err
+			}
+			err = cache.IndexCachedComics(ctx)
+			if err != nil {
+				return "", err
+			}
+			return l("Rebuilt the search index from the cached comic metadata"), nil
+		})
 	})
+	registerAction("apply-image-quota", func() {
+		quota := int64(cw.imageQuota.GetValueAsInt()) * bytesPerMegabyte
+		if quota == app.ImageCacheQuota() {
+			return
+		}
+		if quota > 0 && quota < cache.ImageCacheSize() && !cw.confirmImageEviction(quota) {
+			return
+		}
+		app.SetImageCacheQuota(quota)
+	})
+	registerAction("stop-task", cw.StopTask)
+	cw.actions["stop-task"].SetEnabled(false)
 
 	cw.box.ShowAll()
 	return cw, nil
@@ -130,13 +451,204 @@ func (cw *CacheWindow) Dispose() {
 	cw.metadataLevelBar = nil
 	cw.imageLevelBar.Dispose()
 	cw.imageLevelBar = nil
+	cw.searchIndexSize = nil
+	cw.rebuildSearchIndexButton = nil
+	cw.imageQuota = nil
+	cw.applyImageQuotaButton = nil
+	cw.status = nil
+	cw.comicsExpander = nil
+	cw.cachedComics.Dispose()
+	cw.cachedComics = nil
+	cw.deleteComicsButton = nil
+	cw.refreshComicsButton = nil
 	cw.downloadAllImagesButton = nil
+	cw.verifyImagesButton = nil
+	cw.stopTaskButton = nil
+	cw.exportLibraryButton = nil
+	cw.importLibraryButton = nil
+}
+
+// chooseLibraryFile asks the user to choose a library archive to save to or
+// open, depending on action. Returns false if the user cancelled.
+func (cw *CacheWindow) chooseLibraryFile(action gtk.FileChooserAction, title, acceptLabel string) (string, bool) {
+	dialog, err := gtk.FileChooserNativeDialogNew(title, cw, action, acceptLabel, l("_Cancel"))
+	if err != nil {
+		log.Print("error creating file chooser: ", err)
+		return "", false
+	}
+	defer dialog.Destroy()
+
+	filter, err := gtk.FileFilterNew()
+	if err != nil {
+		log.Print("error creating file filter: ", err)
+		return "", false
+	}
+	filter.SetName(l("Library archives"))
+	filter.AddPattern("*.zip")
+	dialog.AddFilter(filter)
+
+	if action == gtk.FILE_CHOOSER_ACTION_SAVE {
+		dialog.SetDoOverwriteConfirmation(true)
+		dialog.SetCurrentName("xkcd-library.zip")
+	}
+
+	if gtk.ResponseType(dialog.Run()) != gtk.RESPONSE_ACCEPT {
+		return "", false
+	}
+	return dialog.GetFilename(), true
+}
+
+// confirmImageEviction asks the user whether to delete cached comic images so
+// that the image cache fits within quota. Returns false if the user cancelled.
+func (cw *CacheWindow) confirmImageEviction(quota int64) bool {
+	dialog := gtk.MessageDialogNew(cw, gtk.DIALOG_MODAL|gtk.DIALOG_DESTROY_WITH_PARENT, gtk.MESSAGE_QUESTION, gtk.BUTTONS_NONE,
+		l("The image cache uses %v. Delete the least recently viewed comic images until it fits in %v?"),
+		glib.FormatSize(uint64(cache.ImageCacheSize())), glib.FormatSize(uint64(quota)))
+	defer dialog.Destroy()
+
+	dialog.AddButton(l("_Cancel"), gtk.RESPONSE_CANCEL)
+	dialog.AddButton(l("_Delete Images"), gtk.RESPONSE_ACCEPT)
+	dialog.SetDefaultResponse(gtk.RESPONSE_CANCEL)
+
+	return dialog.Run() == gtk.RESPONSE_ACCEPT
+}
+
+// taskActions are the actions that start a background task with runTask. Only
+// one task may run at a time, so they are disabled while a task is running.
+var taskActions = []string{
+	"download-all-images",
+	"verify-images",
+	"export-library",
+	"import-library",
+	"delete-comics",
+	"refresh-comics",
+	"rebuild-search-index",
+}
+
+// runTask runs task in a background goroutine with a context that is cancelled
+// by StopTask. The status label shows description while task is running, then
+// the message returned by task. Must be called in the UI event loop.
+func (cw *CacheWindow) runTask(description string, task func(ctx context.Context) (string, error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cw.cancelTaskMutex.Lock()
+	cw.cancelTask = cancel
+	cw.cancelTaskMutex.Unlock()
+
+	cw.setTaskRunning(true)
+	cw.taskDescription = description
+	cw.status.SetText(description)
+
+	go func() {
+		msg, err := task(ctx)
+		switch {
+		case ctx.Err() != nil:
+			msg = l("Stopped")
+		case err != nil:
+			log.Print("error running cache window task: ", err)
+			msg = fmt.Sprintf(l("Error: %v"), err)
+		}
+		cancel()
+
+		glib.IdleAdd(func() {
+			if cw.status == nil {
+				// The window was disposed while the task was running.
+				return
+			}
+			cw.setTaskRunning(false)
+			cw.taskDescription = ""
+			cw.status.SetText(msg)
+		})
+	}()
+}
+
+func (cw *CacheWindow) setTaskRunning(running bool) {
+	if cw.actions == nil {
+		return
+	}
+	for _, name := range taskActions {
+		cw.actions[name].SetEnabled(!running)
+	}
+	cw.actions["stop-task"].SetEnabled(running)
+}
+
+// StopTask cancels the ongoing background task, if any.
+func (cw *CacheWindow) StopTask() {
+	cw.cancelTaskMutex.Lock()
+	defer cw.cancelTaskMutex.Unlock()
+
+	if cw.cancelTask != nil {
+		cw.cancelTask()
+		cw.cancelTask = nil
+	}
+}
+
+func (cw *CacheWindow) registerProgressObserver() {
+	ch := make(chan cache.ProgressEvent, cache.ProgressObserverBufferSize)
+
+	cw.progressObserverID = cache.AddProgressObserver(ch)
+
+	go func() {
+		for e := range ch {
+			glib.IdleAdd(func() {
+				cw.HandleProgress(e)
+			})
+		}
+	}()
+}
+
+func (cw *CacheWindow) unregisterProgressObserver() {
+	cache.RemoveProgressObserver(cw.progressObserverID)
+}
+
+// HandleProgress updates the window to reflect the progress of a cache
+// operation. Must be called in the UI event loop.
+func (cw *CacheWindow) HandleProgress(e cache.ProgressEvent) {
+	if !cw.IsVisible() {
+		return
+	}
+
+	switch e.Kind {
+	case cache.EventComicFetched, cache.EventFailed:
+		switch e.Operation {
+		case cache.OperationDownloadMetadata:
+			cw.RefreshMetadataWith(e.Stat())
+		case cache.OperationDownloadImages:
+			cw.RefreshImagesWith(e.Stat())
+			cw.showTaskETA(e.ETA)
+		case cache.OperationVerifyImages:
+			cw.showTaskETA(e.ETA)
+		}
+	case cache.EventFinished:
+		switch e.Operation {
+		case cache.OperationDownloadMetadata:
+			go cw.RefreshMetadata()
+			go cw.RefreshSearchIndex()
+		case cache.OperationIndexComics:
+			go cw.RefreshSearchIndex()
+		default:
+			go cw.RefreshImages()
+		}
+		if cw.IsComicsStale() {
+			cw.RefreshComics()
+		}
+	}
+}
+
+// showTaskETA adds the estimated time left to the description of the ongoing
+// task, if any.
+func (cw *CacheWindow) showTaskETA(eta time.Duration) {
+	if cw.taskDescription == "" || eta <= 0 {
+		return
+	}
+	cw.status.SetText(fmt.Sprintf(l("%v (about %v left)"), cw.taskDescription, eta.Round(time.Second)))
 }
 
 func (cw *CacheWindow) Present() {
 	cw.ApplicationWindow.Present()
 	go cw.RefreshMetadata()
 	go cw.RefreshImages()
+	go cw.RefreshSearchIndex()
+	cw.RefreshComics()
 }
 
 func (cw *CacheWindow) IsVisible() bool {
@@ -146,6 +658,9 @@ func (cw *CacheWindow) IsVisible() bool {
 	return cw.ApplicationWindow.IsVisible()
 }
 
+// bytesPerMegabyte matches the units used by glib.FormatSize.
+const bytesPerMegabyte = 1000 * 1000
+
 const stalenessThreshold = 2 * time.Second
 
 func (cw *CacheWindow) IsMetadataStale() bool {
@@ -190,12 +705,10 @@ func (cw *CacheWindow) RefreshMetadataWith(metadata cache.Stat) {
 	cw.lastRefreshMetadataMutex.Lock()
 	defer cw.lastRefreshMetadataMutex.Unlock()
 
-	metaf, err := metadata.Fraction()
+	err := cw.metadataLevelBar.SetStat(metadata)
 	if err != nil {
 		log.Print("error refreshing cache window: ", err)
 	}
-	cw.metadataLevelBar.SetFraction(metaf)
-	cw.metadataLevelBar.SetDetails(metadata.String())
 	cw.lastRefreshMetadata = time.Now()
 }
 
@@ -229,20 +742,72 @@ func (cw *CacheWindow) RefreshImagesWith(images cache.Stat) {
 	cw.lastRefreshImagesMutex.Lock()
 	defer cw.lastRefreshImagesMutex.Unlock()
 
-	imgf, err := images.Fraction()
+	err := cw.imageLevelBar.SetStat(images)
 	if err != nil {
 		log.Print("error refreshing cache window: ", err)
 	}
-	cw.imageLevelBar.SetFraction(imgf)
-	cw.imageLevelBar.SetDetails(images.String())
 	cw.lastRefreshImages = time.Now()
 }
 
+// RefreshSearchIndex updates the displayed size of the search index. Should
+// not be called directly in the UI event loop.
+func (cw *CacheWindow) RefreshSearchIndex() {
+	if !cw.IsVisible() {
+		return
+	}
+
+	size, err := cache.StatSearchIndex()
+	if err != nil {
+		log.Print("error refreshing cache window: ", err)
+		return
+	}
+
+	glib.IdleAdd(func() {
+		if !cw.IsVisible() {
+			return
+		}
+		cw.searchIndexSize.SetText(fmt.Sprintf(l("Search index: %v"), glib.FormatSize(uint64(size))))
+	})
+}
+
+// IsComicsStale returns true if the table of cached comics has not been
+// refreshed recently. Must be called in the UI event loop.
+func (cw *CacheWindow) IsComicsStale() bool {
+	return time.Since(cw.lastRefreshComics) > stalenessThreshold
+}
+
+// RefreshComics updates the table of cached comics in the background, if it is
+// shown. Must be called in the UI event loop.
+func (cw *CacheWindow) RefreshComics() {
+	if !cw.IsVisible() || !cw.comicsExpander.GetExpanded() {
+		return
+	}
+	cw.lastRefreshComics = time.Now()
+
+	go func() {
+		entries, err := cache.ComicEntries()
+		if err != nil {
+			log.Print("error refreshing cache window: ", err)
+			return
+		}
+
+		glib.IdleAdd(func() {
+			if !cw.IsVisible() {
+				return
+			}
+			cw.cachedComics.SetEntries(entries)
+		})
+	}()
+}
+
 type labeledLevelBar struct {
 	*gtk.Box
 	title   *gtk.Label
 	bar     *gtk.LevelBar
 	details *gtk.Label
+
+	// bytes is the last known disk space used, or 0 if unknown.
+	bytes int64
 }
 
 var _ Widget = &labeledLevelBar{}
@@ -306,3 +871,20 @@ func (llb *labeledLevelBar) SetFraction(f float64) {
 func (llb *labeledLevelBar) SetDetails(s string) {
 	llb.details.SetText(s)
 }
+
+// SetStat updates the level bar and details to reflect s. If s does not know
+// the disk space used, the last known value is shown instead.
+func (llb *labeledLevelBar) SetStat(s cache.Stat) error {
+	if s.Bytes > 0 {
+		llb.bytes = s.Bytes
+	}
+
+	f, err := s.Fraction()
+	llb.SetFraction(f)
+	if llb.bytes > 0 {
+		llb.SetDetails(fmt.Sprintf(l("%v (%v)"), s.String(), glib.FormatSize(uint64(llb.bytes))))
+	} else {
+		llb.SetDetails(s.String())
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+package widget
+
+import (
+	"strconv"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+	"github.com/rkoesters/xkcd-gtk/internal/cache"
+	"github.com/rkoesters/xkcd-gtk/internal/log"
+)
+
+const (
+	cachedComicsColumnNumber = iota
+	cachedComicsColumnTitle
+	cachedComicsColumnImage
+	cachedComicsColumnFetched
+	cachedComicsColumnImageSize // Hidden, used to sort the image column.
+)
+
+// CachedComicsView is a table of the comics in the cache, which the user can
+// select several of at once.
+type CachedComicsView struct {
+	*gtk.TreeView
+
+	model     *gtk.ListStore
+	selection *gtk.TreeSelection
+}
+
+var _ Widget = &CachedComicsView{}
+
+func NewCachedComicsView() (*CachedComicsView, error) {
+	super, err := gtk.TreeViewNew()
+	if err != nil {
+		return nil, err
+	}
+	ccv := &CachedComicsView{
+		TreeView: super,
+	}
+
+	ccv.model, err = gtk.ListStoreNew(glib.TYPE_INT, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_INT64)
+	if err != nil {
+		return nil, err
+	}
+	ccv.SetModel(ccv.model)
+
+	ccv.selection, err = ccv.GetSelection()
+	if err != nil {
+		return nil, err
+	}
+	ccv.selection.SetMode(gtk.SELECTION_MULTIPLE)
+
+	ccv.SetHeadersVisible(true)
+	ccv.SetRubberBanding(true)
+	ccv.SetSearchColumn(cachedComicsColumnTitle)
+
+	insertColumn := func(pos, sortPos int, title string, xalign float64, expand bool, ellipsize pango.EllipsizeMode) error {
+		renderer, err := gtk.CellRendererTextNew()
+		if err != nil {
+			return err
+		}
+		renderer.SetAlignment(xalign, 0)
+		renderer.SetProperty("ellipsize", ellipsize)
+		tvc, err := gtk.TreeViewColumnNewWithAttribute(title, renderer, "text", pos)
+		if err != nil {
+			return err
+		}
+		tvc.SetExpand(expand)
+		tvc.SetResizable(true)
+		tvc.SetSortColumnID(sortPos)
+		ccv.AppendColumn(tvc)
+		return nil
+	}
+
+	err = insertColumn(cachedComicsColumnNumber, cachedComicsColumnNumber, "#", 1, false, pango.ELLIPSIZE_NONE)
+	if err != nil {
+		return nil, err
+	}
+	err = insertColumn(cachedComicsColumnTitle, cachedComicsColumnTitle, l("Title"), 0, true, pango.ELLIPSIZE_END)
+	if err != nil {
+		return nil, err
+	}
+	err = insertColumn(cachedComicsColumnImage, cachedComicsColumnImageSize, l("Image"), 1, false, pango.ELLIPSIZE_NONE)
+	if err != nil {
+		return nil, err
+	}
+	err = insertColumn(cachedComicsColumnFetched, cachedComicsColumnFetched, l("Fetched"), 0, false, pango.ELLIPSIZE_NONE)
+	if err != nil {
+		return nil, err
+	}
+
+	return ccv, nil
+}
+
+func (ccv *CachedComicsView) Dispose() {
+	if ccv == nil {
+		return
+	}
+
+	ccv.TreeView = nil
+	ccv.model = nil
+	ccv.selection = nil
+}
+
+// SetEntries replaces the rows of the table with entries. Must be called in the
+// UI event loop.
+func (ccv *CachedComicsView) SetEntries(entries []cache.ComicEntry) {
+	ccv.model.Clear()
+	for _, e := range entries {
+		image := l("None")
+		if e.HasImage {
+			image = glib.FormatSize(uint64(e.ImageSize))
+		}
+		fetched := l("Unknown")
+		if !e.FetchedAt.IsZero() {
+			fetched = e.FetchedAt.Local().Format("2006-01-02")
+		}
+		title := e.SafeTitle
+		if title == "" {
+			title = strconv.Itoa(e.Num)
+		}
+
+		err := ccv.model.Set(
+			ccv.model.Append(),
+			[]int{
+				cachedComicsColumnNumber,
+				cachedComicsColumnTitle,
+				cachedComicsColumnImage,
+				cachedComicsColumnFetched,
+				cachedComicsColumnImageSize,
+			},
+			[]any{e.Num, title, image, fetched, e.ImageSize},
+		)
+		if err != nil {
+			log.Print("error adding cached comic to table: ", err)
+		}
+	}
+}
+
+// SelectedComics returns the numbers of the selected comics. Must be called in
+// the UI event loop.
+func (ccv *CachedComicsView) SelectedComics() []int {
+	var comics []int
+	ccv.selection.SelectedForEach(func(model *gtk.TreeModel, path *gtk.TreePath, iter *gtk.TreeIter) {
+		val, err := model.GetValue(iter, cachedComicsColumnNumber)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		id, err := val.GoValue()
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		n, ok := id.(int)
+		if !ok {
+			log.Print("error converting val to int")
+			return
+		}
+		comics = append(comics, n)
+	})
+	return comics
+}
@@ -7,7 +7,7 @@ import (
 
 const (
 	comicListColumnNumber = iota
-	comicListColumnTitle
+	comicListColumnTitle  // Pango markup.
 )
 
 type ComicListModel struct {
@@ -25,9 +25,19 @@ func NewComicListModel() (*ComicListModel, error) {
 }
 
 func (clm *ComicListModel) AppendComic(comicNum int, comicTitle string) error {
+	return clm.AppendComicWithSnippet(comicNum, comicTitle, "")
+}
+
+// AppendComicWithSnippet is like AppendComic, but also shows snippet, which is
+// Pango markup, on a second line below the title.
+func (clm *ComicListModel) AppendComicWithSnippet(comicNum int, comicTitle, snippet string) error {
+	markup := glib.MarkupEscapeText(comicTitle)
+	if snippet != "" {
+		markup += "\n<small>" + snippet + "</small>"
+	}
 	return clm.Set(
 		clm.Append(),
 		[]int{comicListColumnNumber, comicListColumnTitle},
-		append([]any{}, comicNum, comicTitle),
+		append([]any{}, comicNum, markup),
 	)
 }
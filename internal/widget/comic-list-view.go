@@ -34,7 +34,7 @@ func NewComicListView(comicSetter func(int)) (*ComicListView, error) {
 	clv.SetActivateOnSingleClick(true)
 	clv.SetHoverSelection(true)
 
-	insertColumn := func(pos, xpad int, xalign float64, expand bool, ellipsize pango.EllipsizeMode) (*gtk.TreeViewColumn, error) {
+	insertColumn := func(pos int, attribute string, xpad int, xalign float64, expand bool, ellipsize pango.EllipsizeMode) (*gtk.TreeViewColumn, error) {
 		renderer, err := gtk.CellRendererTextNew()
 		if err != nil {
 			return nil, err
@@ -43,7 +43,7 @@ func NewComicListView(comicSetter func(int)) (*ComicListView, error) {
 		renderer.SetProperty("xpad", xpad)
 		renderer.SetProperty("ypad", 6)
 		renderer.SetProperty("ellipsize", ellipsize)
-		tvc, err := gtk.TreeViewColumnNewWithAttribute(strconv.Itoa(pos), renderer, "text", pos)
+		tvc, err := gtk.TreeViewColumnNewWithAttribute(strconv.Itoa(pos), renderer, attribute, pos)
 		if err != nil {
 			return nil, err
 		}
@@ -54,12 +54,12 @@ func NewComicListView(comicSetter func(int)) (*ComicListView, error) {
 		return tvc, nil
 	}
 
-	clv.numberColumn, err = insertColumn(comicListColumnNumber, 4, 1, false, pango.ELLIPSIZE_NONE)
+	clv.numberColumn, err = insertColumn(comicListColumnNumber, "text", 4, 1, false, pango.ELLIPSIZE_NONE)
 	if err != nil {
 		return nil, err
 	}
 
-	clv.titleColumn, err = insertColumn(comicListColumnTitle, 0, 0, true, pango.ELLIPSIZE_END)
+	clv.titleColumn, err = insertColumn(comicListColumnTitle, "markup", 0, 0, true, pango.ELLIPSIZE_END)
 	if err != nil {
 		return nil, err
 	}
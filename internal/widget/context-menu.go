@@ -10,13 +10,14 @@ import (
 type ContextMenu struct {
 	*PopoverMenu
 
-	bookmarkButton *CheckModelButton
-	zoomBox        *ZoomBox
+	bookmarkButton  *CheckModelButton
+	animationButton *CheckModelButton // Only visible for animated comics.
+	zoomBox         *ZoomBox
 }
 
 var _ Widget = &ContextMenu{}
 
-func NewContextMenu(relative gtk.IWidget, actionGroup glib.IActionGroup, bookmarkedGetter func() bool, bookmarkedSetter func(bool)) (*ContextMenu, error) {
+func NewContextMenu(relative gtk.IWidget, actionGroup glib.IActionGroup, bookmarkedGetter func() bool, bookmarkedSetter func(bool), playingGetter func() bool, playingSetter func(bool)) (*ContextMenu, error) {
 	super, err := NewPopoverMenu(relative)
 	if err != nil {
 		return nil, err
@@ -32,6 +33,12 @@ func NewContextMenu(relative gtk.IWidget, actionGroup glib.IActionGroup, bookmar
 		return nil, err
 	}
 
+	cm.animationButton, err = cm.AddCheckButton(l("Play animation"), playingGetter, playingSetter)
+	if err != nil {
+		return nil, err
+	}
+	cm.animationButton.SetNoShowAll(true)
+
 	if err = cm.AddSeparator(); err != nil {
 		return nil, err
 	}
@@ -67,6 +74,8 @@ func (cm *ContextMenu) Dispose() {
 	cm.PopoverMenu = nil
 	cm.bookmarkButton.Dispose()
 	cm.bookmarkButton = nil
+	cm.animationButton.Dispose()
+	cm.animationButton = nil
 	cm.zoomBox.Dispose()
 	cm.zoomBox = nil
 }
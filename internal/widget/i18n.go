@@ -1,7 +1,26 @@
 package widget
 
+// #cgo pkg-config: glib-2.0
+// #include <stdlib.h>
+// #include <glib.h>
+import "C"
+
 import (
+	"unsafe"
+
 	"github.com/gotk3/gotk3/glib"
 )
 
 var l = glib.Local
+
+// ln localizes a string with singular and plural forms, picking the form that
+// matches n, using g_dngettext, which gotk3 does not wrap.
+func ln(singular, plural string, n uint64) string {
+	cSingular := C.CString(singular)
+	defer C.free(unsafe.Pointer(cSingular))
+	cPlural := C.CString(plural)
+	defer C.free(unsafe.Pointer(cPlural))
+
+	s := C.g_dngettext(nil, (*C.gchar)(cSingular), (*C.gchar)(cPlural), C.gulong(n))
+	return C.GoString((*C.char)(s))
+}
@@ -16,13 +16,34 @@ import (
 type ImageViewer struct {
 	*gtk.ScrolledWindow
 
+	stack          *gtk.Stack
 	image          *gtk.Image
 	unscaledPixbuf *gdk.Pixbuf // will be inverted in dark mode
 	scale          float64
 	finalPixbuf    *gdk.Pixbuf // displayed to the user
 
+	// animation is the comic image if it has multiple frames, otherwise nil.
+	// unscaledPixbuf is the frame being shown.
+	animation       *animation
+	frame           int
+	animationPaused bool
+	animationTimer  glib.SourceHandle // 0 if no timer is pending.
+
+	// The comic being displayed, and the variant of its image (with its
+	// pixel density) that unscaledPixbuf was loaded from.
+	comicId  int
+	kind     cache.ComicKind
+	darkMode bool
+	variant  cache.ImageVariant
+	density  float64
+
 	eventBox *gtk.EventBox
 
+	// placeholder is shown instead of the image for comics that can not be
+	// displayed here (see cache.ComicKind).
+	placeholder      *gtk.Box
+	placeholderLabel *gtk.Label
+
 	contextMenu *ContextMenu
 }
 
@@ -36,7 +57,8 @@ func NewImageViewer(actionGroup glib.IActionGroup, imageScale float64, bookmarke
 	iv := &ImageViewer{
 		ScrolledWindow: super,
 
-		scale: safeScale(imageScale),
+		scale:   safeScale(imageScale),
+		density: 1,
 	}
 
 	iv.SetSizeRequest(500, 400)
@@ -59,9 +81,60 @@ func NewImageViewer(actionGroup glib.IActionGroup, imageScale float64, bookmarke
 		return nil, err
 	}
 	iv.eventBox.Add(iv.image)
-	iv.Add(iv.eventBox)
 
-	iv.contextMenu, err = NewContextMenu(iv.eventBox, actionGroup, bookmarkedGetter, bookmarkedSetter)
+	iv.placeholder, err = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, style.PaddingComicPlaceholder)
+	if err != nil {
+		return nil, err
+	}
+	iv.placeholder.SetHAlign(gtk.ALIGN_CENTER)
+	iv.placeholder.SetVAlign(gtk.ALIGN_CENTER)
+
+	placeholderIcon, err := gtk.ImageNewFromIconName("web-browser-symbolic", gtk.ICON_SIZE_DIALOG)
+	if err != nil {
+		return nil, err
+	}
+	iv.placeholder.PackStart(placeholderIcon, false, false, 0)
+
+	iv.placeholderLabel, err = gtk.LabelNew("")
+	if err != nil {
+		return nil, err
+	}
+	iv.placeholderLabel.SetLineWrap(true)
+	iv.placeholderLabel.SetJustify(gtk.JUSTIFY_CENTER)
+	iv.placeholderLabel.SetMaxWidthChars(40)
+	iv.placeholder.PackStart(iv.placeholderLabel, false, false, 0)
+
+	openButton, err := gtk.ButtonNewWithLabel(l("Open in browser"))
+	if err != nil {
+		return nil, err
+	}
+	openButton.SetActionName("win.open-in-browser")
+	openButton.SetHAlign(gtk.ALIGN_CENTER)
+	iv.placeholder.PackStart(openButton, false, false, 0)
+
+	iv.stack, err = gtk.StackNew()
+	if err != nil {
+		return nil, err
+	}
+	iv.stack.Add(iv.eventBox)
+	iv.stack.Add(iv.placeholder)
+	iv.Add(iv.stack)
+
+	// Moving the window to a screen with a different scale factor may call
+	// for a different variant of the comic image, and decides whether the
+	// cache downloads the variants.
+	iv.Connect("notify::scale-factor", func() {
+		cache.SetDisplayScale(iv.GetScaleFactor())
+		if iv.unscaledPixbuf == nil {
+			return
+		}
+		err := iv.loadImage()
+		if err != nil {
+			log.Print("error redrawing comic for new scale factor: ", err)
+		}
+	})
+
+	iv.contextMenu, err = NewContextMenu(iv.eventBox, actionGroup, bookmarkedGetter, bookmarkedSetter, iv.AnimationPlaying, iv.SetAnimationPlaying)
 	if err != nil {
 		return nil, err
 	}
@@ -87,12 +160,18 @@ func (iv *ImageViewer) Dispose() {
 		return
 	}
 
+	iv.stopAnimation()
+	iv.animation = nil
+
 	iv.ScrolledWindow = nil
 
+	iv.stack = nil
 	iv.image = nil
 	iv.unscaledPixbuf = nil
 	iv.finalPixbuf = nil
 	iv.eventBox = nil
+	iv.placeholder = nil
+	iv.placeholderLabel = nil
 
 	iv.contextMenu.Dispose()
 	iv.contextMenu = nil
@@ -100,17 +179,27 @@ func (iv *ImageViewer) Dispose() {
 
 func (iv *ImageViewer) ShowLoadingScreen() {
 	iv.image.SetFromIconName("image-loading-symbolic", gtk.ICON_SIZE_DIALOG)
+	iv.stack.SetVisibleChild(iv.eventBox)
 }
 
 func (iv *ImageViewer) SetScale(scale float64) float64 {
-	var err error
 	iv.scale = safeScale(scale)
-	iv.finalPixbuf, err = scaleImage(iv.unscaledPixbuf, iv.scale)
+	if iv.kind != cache.ComicKindImage {
+		// The zoom level will apply to the next comic with an image.
+		return iv.scale
+	}
+
+	// Zooming in may call for a higher resolution variant of the image.
+	var err error
+	if v, _ := cache.ComicImageVariant(iv.comicId, iv.targetDensity()); v != iv.variant {
+		err = iv.loadImage()
+	} else {
+		err = iv.render()
+	}
 	if err != nil {
 		log.Print(err)
 		return 0
 	}
-	iv.image.SetFromPixbuf(iv.finalPixbuf)
 	return iv.scale
 }
 
@@ -126,35 +215,179 @@ func (iv *ImageViewer) ZoomOut() float64 {
 
 func (iv *ImageViewer) DrawComic(comicId int, darkMode bool) error {
 	log.Debugf("DrawComic(id=%v, darkMode=%v)", comicId, darkMode)
-	path := cache.ComicImagePath(comicId)
-	var err error
-	iv.unscaledPixbuf, err = gdk.PixbufNewFromFile(path)
+	cache.SetDisplayScale(iv.GetScaleFactor())
+	iv.comicId = comicId
+	iv.darkMode = darkMode
+	iv.kind = cache.ComicKindOf(comicId)
+	if iv.kind != cache.ComicKindImage {
+		iv.showPlaceholder()
+		return nil
+	}
+	iv.stack.SetVisibleChild(iv.eventBox)
+	return iv.loadImage()
+}
+
+// showPlaceholder explains why the comic can not be displayed, instead of
+// showing the comic image.
+func (iv *ImageViewer) showPlaceholder() {
+	switch iv.kind {
+	case cache.ComicKindInteractive:
+		iv.placeholderLabel.SetText(l("This comic is interactive, so it can only be viewed in a web browser."))
+	default:
+		iv.placeholderLabel.SetText(l("This comic does not have an image that can be shown here."))
+	}
+	iv.stopAnimation()
+	iv.setAnimation(nil)
+	iv.unscaledPixbuf = nil
+	iv.finalPixbuf = nil
+	iv.stack.SetVisibleChild(iv.placeholder)
+}
+
+// targetDensity returns the pixel density, relative to the standard comic
+// image, needed to display the comic sharply at the current zoom level.
+func (iv *ImageViewer) targetDensity() float64 {
+	return float64(iv.GetScaleFactor()) * iv.scale
+}
+
+// loadImage loads the cached variant of the comic image that best matches the
+// screen's scale factor and the current zoom level, then displays it.
+func (iv *ImageViewer) loadImage() error {
+	variant, density := cache.ComicImageVariant(iv.comicId, iv.targetDensity())
+	log.Debugf("loading %v variant of comic image %v", variant, iv.comicId)
+	path := cache.ComicImageVariantPath(iv.comicId, variant)
+
+	iv.stopAnimation()
+	anim, err := loadAnimation(path)
+	if err != nil {
+		// Fall back to showing the first frame.
+		log.Print("error loading comic image animation: ", err)
+	}
+	if anim != nil {
+		if iv.darkMode {
+			for _, frame := range anim.frames {
+				err = invertLightness(frame)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		iv.setAnimation(anim)
+		iv.frame = 0
+		iv.unscaledPixbuf = anim.frames[0]
+		iv.variant = variant
+		iv.density = density
+		iv.startAnimation()
+		return iv.render()
+	}
+
+	pixbuf, err := gdk.PixbufNewFromFile(path)
 	if err != nil {
 		return err
 	}
-	if darkMode {
-		err = iv.applyDarkModeImageInversion()
+	iv.setAnimation(nil)
+	iv.unscaledPixbuf = pixbuf
+	iv.variant = variant
+	iv.density = density
+	if iv.darkMode {
+		err = invertLightness(iv.unscaledPixbuf)
 		if err != nil {
 			return err
 		}
 	}
-	iv.finalPixbuf, err = scaleImage(iv.unscaledPixbuf, iv.scale)
+	return iv.render()
+}
+
+// setAnimation sets the animation being shown, and only offers to play or
+// pause it if there is one.
+func (iv *ImageViewer) setAnimation(anim *animation) {
+	iv.animation = anim
+	iv.contextMenu.animationButton.SetVisible(anim != nil)
+}
+
+// AnimationPlaying returns true if animated comic images should play.
+func (iv *ImageViewer) AnimationPlaying() bool {
+	return !iv.animationPaused
+}
+
+// SetAnimationPlaying plays or pauses animated comic images.
+func (iv *ImageViewer) SetAnimationPlaying(playing bool) {
+	iv.animationPaused = !playing
+	iv.contextMenu.animationButton.SyncState(playing)
+	if playing {
+		iv.startAnimation()
+	} else {
+		iv.stopAnimation()
+	}
+}
+
+// startAnimation schedules the next frame of the animation, if there is one
+// and it is not paused.
+func (iv *ImageViewer) startAnimation() {
+	if iv.animation == nil || iv.animationPaused || iv.animationTimer != 0 {
+		return
+	}
+	delay := iv.animation.delays[iv.frame]
+	iv.animationTimer = glib.TimeoutAdd(uint(delay.Milliseconds()), iv.nextFrame)
+}
+
+// stopAnimation cancels the next frame of the animation, if it is scheduled.
+func (iv *ImageViewer) stopAnimation() {
+	if iv.animationTimer != 0 {
+		glib.SourceRemove(iv.animationTimer)
+		iv.animationTimer = 0
+	}
+}
+
+// nextFrame shows the next frame of the animation and schedules the one after
+// it. Always returns false, as each frame needs its own timer.
+func (iv *ImageViewer) nextFrame() bool {
+	iv.animationTimer = 0
+	if iv.animation == nil {
+		return false
+	}
+
+	iv.frame = (iv.frame + 1) % len(iv.animation.frames)
+	iv.unscaledPixbuf = iv.animation.frames[iv.frame]
+	err := iv.render()
+	if err != nil {
+		log.Print("error drawing comic animation frame: ", err)
+		return false
+	}
+	iv.startAnimation()
+	return false
+}
+
+// render scales unscaledPixbuf to the current zoom level and displays it.
+func (iv *ImageViewer) render() error {
+	// Scale the image to the number of device pixels needed, then tell GTK
+	// about the screen's scale factor so that it does not scale the image
+	// up again.
+	factor := iv.GetScaleFactor()
+	var err error
+	iv.finalPixbuf, err = scaleImage(iv.unscaledPixbuf, iv.scale*float64(factor)/iv.density)
+	if err != nil {
+		return err
+	}
+	window, _ := iv.GetWindow() // May be nil if we are not realized yet.
+	surface, err := gdk.CairoSurfaceCreateFromPixbuf(iv.finalPixbuf, factor, window)
 	if err != nil {
 		return err
 	}
-	iv.image.SetFromPixbuf(iv.finalPixbuf)
+	iv.image.SetFromSurface(surface)
 	return nil
 }
 
-func (iv *ImageViewer) applyDarkModeImageInversion() error {
-	pixels := iv.unscaledPixbuf.GetPixels()
-	colorspace := iv.unscaledPixbuf.GetColorspace()
-	alpha := iv.unscaledPixbuf.GetHasAlpha()
-	bitsPerSample := iv.unscaledPixbuf.GetBitsPerSample()
-	width := iv.unscaledPixbuf.GetWidth()
-	height := iv.unscaledPixbuf.GetHeight()
-	rowstride := iv.unscaledPixbuf.GetRowstride()
-	nChannels := iv.unscaledPixbuf.GetNChannels()
+// invertLightness inverts the lightness of every pixel in pixbuf, for showing
+// comics in dark mode.
+func invertLightness(pixbuf *gdk.Pixbuf) error {
+	pixels := pixbuf.GetPixels()
+	colorspace := pixbuf.GetColorspace()
+	alpha := pixbuf.GetHasAlpha()
+	bitsPerSample := pixbuf.GetBitsPerSample()
+	width := pixbuf.GetWidth()
+	height := pixbuf.GetHeight()
+	rowstride := pixbuf.GetRowstride()
+	nChannels := pixbuf.GetNChannels()
 	log.Debugf("inverting comic image: len(pixels) = %v, colorspace = %v, alpha = %v, bitsPerSample = %v, width = %v, height = %v, rowstride = %v, nChannels = %v", len(pixels), colorspace, alpha, bitsPerSample, width, height, rowstride, nChannels)
 
 	for y := 0; y < height; y++ {
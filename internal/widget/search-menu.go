@@ -1,14 +1,20 @@
 package widget
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/blevesearch/bleve/v2"
 	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 	"github.com/rkoesters/xkcd-gtk/internal/cache"
 	"github.com/rkoesters/xkcd-gtk/internal/log"
+	"github.com/rkoesters/xkcd-gtk/internal/search"
 	"github.com/rkoesters/xkcd-gtk/internal/style"
 )
 
@@ -18,18 +24,51 @@ type SearchMenu struct {
 	popover         *gtk.Popover
 	popoverBox      *gtk.Box
 	entry           *gtk.SearchEntry
+	completion      *gtk.EntryCompletion
+	suggestions     *gtk.ListStore
 	indexing        *gtk.Label
+	resultsHeader   *gtk.Box
+	resultsCount    *gtk.Label
+	sortOrder       *gtk.ComboBoxText
 	resultsStack    *gtk.Stack
+	resultsNoneBox  *gtk.Box
 	resultsNone     *gtk.Label
+	didYouMean      *gtk.Button
+	resultsError    *gtk.Label
 	resultsScroller *gtk.ScrolledWindow
 	resultsList     *ComicListView
+	resultsModel    *ComicListModel
 
-	searcher func(string) (*bleve.SearchResult, error)
+	// userQuery is the query of the results being shown, and loaded is how
+	// many of its total results are in resultsModel.
+	userQuery string
+	loaded    int
+	total     uint64
+	// correction is the query offered by the didYouMean button.
+	correction string
+
+	searcher  func(userQuery string, offset, limit int, order search.SortOrder) (*bleve.SearchResult, error)
+	suggester func(prefix string, limit int) ([]string, error)
+	corrector func(userQuery string) (string, error)
 }
 
+// searchPageSize is how many search results are loaded at a time.
+const searchPageSize = 50
+
+// searchLoadMoreMargin is how close, in pixels, the user needs to scroll to the
+// end of the search results before more results are loaded.
+const searchLoadMoreMargin = 100
+
+// searchSuggestionLimit is how many words are suggested to complete the word
+// being typed, once it is at least searchSuggestionMinLength characters long.
+const (
+	searchSuggestionLimit     = 8
+	searchSuggestionMinLength = 2
+)
+
 var _ Widget = &SearchMenu{}
 
-func NewSearchMenu(accels *gtk.AccelGroup, comicSetter func(int), searcher func(string) (*bleve.SearchResult, error)) (*SearchMenu, error) {
+func NewSearchMenu(accels *gtk.AccelGroup, comicSetter func(int), searcher func(string, int, int, search.SortOrder) (*bleve.SearchResult, error), suggester func(string, int) ([]string, error), corrector func(string) (string, error)) (*SearchMenu, error) {
 	super, err := gtk.MenuButtonNew()
 	if err != nil {
 		return nil, err
@@ -37,6 +76,8 @@ func NewSearchMenu(accels *gtk.AccelGroup, comicSetter func(int), searcher func(
 	sm := &SearchMenu{
 		MenuButton: super,
 		searcher:   searcher,
+		suggester:  suggester,
+		corrector:  corrector,
 	}
 
 	sm.SetTooltipText(l("Search comics"))
@@ -62,15 +103,59 @@ func NewSearchMenu(accels *gtk.AccelGroup, comicSetter func(int), searcher func(
 		return nil, err
 	}
 	sm.entry.SetSizeRequest(280, -1)
+	sm.entry.SetTooltipText(l("Filter with num:, year:, date:, title:, alt: or transcript:, and combine terms with AND, OR and NOT"))
 	sm.entry.Connect("search-changed", sm.Search)
+	// Must be connected before the completion is set, so that the
+	// suggestions are up to date when the completion looks at them.
+	sm.entry.Connect("changed", sm.updateSuggestions)
 	sm.popoverBox.Add(sm.entry)
 
+	sm.suggestions, err = gtk.ListStoreNew(glib.TYPE_STRING)
+	if err != nil {
+		return nil, err
+	}
+	sm.completion, err = gtk.EntryCompletionNew()
+	if err != nil {
+		return nil, err
+	}
+	sm.completion.SetModel(sm.suggestions)
+	sm.completion.SetTextColumn(0)
+	sm.completion.SetMinimumKeyLength(searchSuggestionMinLength)
+	sm.entry.SetCompletion(sm.completion)
+
 	sm.indexing, err = gtk.LabelNew(l("Updating comic search index..."))
 	if err != nil {
 		return nil, err
 	}
 	sm.popoverBox.Add(sm.indexing)
 
+	sm.resultsHeader, err = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, style.PaddingPopover)
+	if err != nil {
+		return nil, err
+	}
+	sm.popoverBox.Add(sm.resultsHeader)
+
+	sm.resultsCount, err = gtk.LabelNew("")
+	if err != nil {
+		return nil, err
+	}
+	sm.resultsCount.SetXAlign(0)
+	sm.resultsHeader.PackStart(sm.resultsCount, true, true, 0)
+
+	sm.sortOrder, err = gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	// Must be in the same order as the search.SortOrder constants.
+	sm.sortOrder.AppendText(l("Relevance"))
+	sm.sortOrder.AppendText(l("Newest"))
+	sm.sortOrder.AppendText(l("Oldest"))
+	sm.sortOrder.AppendText(l("Number"))
+	sm.sortOrder.SetActive(int(search.SortRelevance))
+	sm.sortOrder.SetTooltipText(l("Sort results"))
+	sm.sortOrder.Connect("changed", sm.Search)
+	sm.resultsHeader.PackEnd(sm.sortOrder, false, false, 0)
+
 	sm.resultsStack, err = gtk.StackNew()
 	if err != nil {
 		return nil, err
@@ -78,17 +163,47 @@ func NewSearchMenu(accels *gtk.AccelGroup, comicSetter func(int), searcher func(
 	sm.resultsStack.SetHomogeneous(false)
 	sm.popoverBox.Add(sm.resultsStack)
 
+	sm.resultsNoneBox, err = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, style.PaddingPopover)
+	if err != nil {
+		return nil, err
+	}
+	sm.resultsStack.Add(sm.resultsNoneBox)
+
 	sm.resultsNone, err = gtk.LabelNew(l("No results found"))
 	if err != nil {
 		return nil, err
 	}
-	sm.resultsStack.Add(sm.resultsNone)
+	sm.resultsNoneBox.Add(sm.resultsNone)
+
+	sm.didYouMean, err = gtk.ButtonNewWithLabel("")
+	if err != nil {
+		return nil, err
+	}
+	sm.didYouMean.SetRelief(gtk.RELIEF_NONE)
+	sm.didYouMean.SetNoShowAll(true)
+	sm.didYouMean.Connect("clicked", func() {
+		sm.entry.SetText(sm.correction)
+	})
+	sm.resultsNoneBox.Add(sm.didYouMean)
+
+	sm.resultsError, err = gtk.LabelNew("")
+	if err != nil {
+		return nil, err
+	}
+	sm.resultsError.SetLineWrap(true)
+	sm.resultsError.SetMaxWidthChars(40)
+	sm.resultsStack.Add(sm.resultsError)
 
 	sm.resultsScroller, err = NewComicListScroller()
 	if err != nil {
 		return nil, err
 	}
 	sm.resultsStack.Add(sm.resultsScroller)
+	// The adjustment changes when a page of search results has been laid
+	// out, so more results are loaded right away if they don't fill the
+	// scroller yet.
+	sm.resultsScroller.GetVAdjustment().Connect("value-changed", sm.resultsScrolled)
+	sm.resultsScroller.GetVAdjustment().Connect("changed", sm.resultsScrolled)
 
 	sm.resultsList, err = NewComicListView(func(n int) {
 		comicSetter(n)
@@ -114,16 +229,27 @@ func (sm *SearchMenu) Dispose() {
 
 	sm.MenuButton = nil
 	sm.searcher = nil
+	sm.suggester = nil
+	sm.corrector = nil
 
 	sm.popover = nil
 	sm.popoverBox = nil
 	sm.entry = nil
+	sm.completion = nil
+	sm.suggestions = nil
 	sm.indexing = nil
+	sm.resultsHeader = nil
+	sm.resultsCount = nil
+	sm.sortOrder = nil
 	sm.resultsStack = nil
+	sm.resultsNoneBox = nil
 	sm.resultsNone = nil
+	sm.didYouMean = nil
+	sm.resultsError = nil
 	sm.resultsScroller = nil
 	sm.resultsList.Dispose()
 	sm.resultsList = nil
+	sm.resultsModel = nil
 }
 
 // Search preforms a search with win.searchEntry.GetText() and puts the results
@@ -140,37 +266,145 @@ func (sm *SearchMenu) Search() {
 		}
 		return
 	}
-	result, err := sm.searcher(userQuery)
-	if err != nil {
+	result, err := sm.searcher(userQuery, 0, searchPageSize, sm.selectedSortOrder())
+	var syntaxErr *search.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		sm.showSyntaxError(syntaxErr)
+		return
+	} else if err != nil {
 		log.Print("error getting search results: ", err)
 	}
+	sm.userQuery = userQuery
 	err = sm.loadSearchResults(result)
 	if err != nil {
 		log.Print("error displaying search results: ", err)
 	}
 }
 
-func (sm *SearchMenu) refreshIndexingStatus() error {
-	s, err := cache.StatMetadata()
+func (sm *SearchMenu) selectedSortOrder() search.SortOrder {
+	return search.SortOrder(sm.sortOrder.GetActive())
+}
+
+// resultsScrolled loads more search results when the end of the results that
+// are already shown is visible, either because the user scrolled near it or
+// because the results don't fill the scroller.
+func (sm *SearchMenu) resultsScrolled(adj *gtk.Adjustment) {
+	if adj.GetValue()+adj.GetPageSize() < adj.GetUpper()-searchLoadMoreMargin {
+		return
+	}
+	if sm.resultsModel == nil || uint64(sm.loaded) >= sm.total {
+		return
+	}
+	result, err := sm.searcher(sm.userQuery, sm.loaded, searchPageSize, sm.selectedSortOrder())
 	if err != nil {
-		return err
+		log.Print("error getting more search results: ", err)
+		return
+	}
+	err = sm.appendSearchResults(result)
+	if err != nil {
+		log.Print("error displaying more search results: ", err)
 	}
-	sm.indexing.SetVisible(!s.Complete())
-	return nil
 }
 
-// Show the user the given search results.
-func (sm *SearchMenu) loadSearchResults(result *bleve.SearchResult) error {
-	err := sm.refreshIndexingStatus()
+func (sm *SearchMenu) refreshIndexingStatus() {
+	sm.indexing.SetVisible(cache.OperationRunning(cache.OperationDownloadMetadata) || cache.OperationRunning(cache.OperationIndexComics))
+}
+
+// updatesSearchIndex returns true if op adds comics to the search index.
+func updatesSearchIndex(op cache.Operation) bool {
+	return op == cache.OperationDownloadMetadata || op == cache.OperationIndexComics
+}
+
+// HandleProgress shows whether the search index is being updated based on the
+// progress of a cache operation. Must be called in the UI event loop.
+func (sm *SearchMenu) HandleProgress(e cache.ProgressEvent) {
+	if sm == nil || !updatesSearchIndex(e.Operation) {
+		return
+	}
+	switch e.Kind {
+	case cache.EventStarted:
+		sm.indexing.SetVisible(true)
+	case cache.EventFinished:
+		sm.refreshIndexingStatus()
+	}
+}
+
+// showDidYouMean offers the user a correction of a search query that has no
+// results, if there is one.
+func (sm *SearchMenu) showDidYouMean() {
+	correction, err := sm.corrector(sm.userQuery)
 	if err != nil {
-		return err
+		log.Print("error correcting search query: ", err)
+	}
+	sm.correction = correction
+	sm.didYouMean.SetLabel(fmt.Sprintf(l("Did you mean: %v"), correction))
+	sm.didYouMean.SetVisible(correction != "")
+}
+
+// updateSuggestions fills the completion list of the search entry with words
+// that complete the word being typed.
+func (sm *SearchMenu) updateSuggestions() {
+	sm.suggestions.Clear()
+
+	text, err := sm.entry.GetText()
+	if err != nil {
+		log.Print("error getting search text: ", err)
+		return
+	}
+	start := 0
+	if i := strings.LastIndexFunc(text, isSuggestionBoundary); i >= 0 {
+		_, size := utf8.DecodeRuneInString(text[i:])
+		start = i + size
+	}
+	prefix := text[start:]
+	if utf8.RuneCountInString(prefix) < searchSuggestionMinLength {
+		return
 	}
+
+	words, err := sm.suggester(prefix, searchSuggestionLimit)
+	if err != nil {
+		log.Print("error getting search suggestions: ", err)
+		return
+	}
+	for _, word := range words {
+		// The completion matches against the whole search text.
+		err = sm.suggestions.SetValue(sm.suggestions.Append(), 0, text[:start]+word)
+		if err != nil {
+			log.Print("error adding search suggestion: ", err)
+		}
+	}
+}
+
+// isSuggestionBoundary returns true if r separates the word being typed from
+// the rest of the search text.
+func isSuggestionBoundary(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`()":-`, r)
+}
+
+// showSyntaxError tells the user why their search query is malformed.
+func (sm *SearchMenu) showSyntaxError(err *search.SyntaxError) {
+	sm.refreshIndexingStatus()
+	sm.resultsError.SetText(fmt.Sprintf(l("Invalid search: %v"), err))
+	sm.resultsHeader.SetVisible(false)
+	sm.resultsStack.SetVisible(true)
+	sm.resultsStack.SetVisibleChild(sm.resultsError)
+	sm.resultsModel = nil
+}
+
+// Show the user the given search results, replacing the results that are
+// already shown.
+func (sm *SearchMenu) loadSearchResults(result *bleve.SearchResult) error {
+	sm.refreshIndexingStatus()
+	sm.resultsHeader.SetVisible(result != nil)
 	sm.resultsStack.SetVisible(result != nil)
+	sm.resultsModel = nil
 	if result == nil {
 		return nil
 	}
+	sm.resultsCount.SetText(fmt.Sprintf(ln("%v result", "%v results", result.Total), result.Total))
 	if result.Hits.Len() == 0 {
-		sm.resultsStack.SetVisibleChild(sm.resultsNone)
+		sm.showDidYouMean()
+		sm.resultsStack.SetVisibleChild(sm.resultsNoneBox)
 		return nil
 	}
 	sm.resultsStack.SetVisibleChild(sm.resultsScroller)
@@ -179,17 +413,40 @@ func (sm *SearchMenu) loadSearchResults(result *bleve.SearchResult) error {
 	if err != nil {
 		return err
 	}
+	sm.resultsModel = clm
+	sm.loaded = 0
+	sm.total = result.Total
+	err = sm.appendSearchResults(result)
+	if err != nil {
+		return err
+	}
+	sm.resultsList.SetModel(clm)
+	sm.resultsScroller.GetVAdjustment().SetValue(0)
+	return nil
+}
 
+// appendSearchResults adds the next page of search results to the results
+// that are already shown.
+func (sm *SearchMenu) appendSearchResults(result *bleve.SearchResult) error {
 	for _, sr := range result.Hits {
 		comicNum, err := strconv.Atoi(sr.ID)
 		if err != nil {
 			return err
 		}
-		err = clm.AppendComic(comicNum, fmt.Sprint(sr.Fields["safe_title"]))
+		snippet := snippetMarkup.Replace(search.Snippet(sr))
+		err = sm.resultsModel.AppendComicWithSnippet(comicNum, fmt.Sprint(sr.Fields["safe_title"]), snippet)
 		if err != nil {
 			return err
 		}
+		sm.loaded++
 	}
-	sm.resultsList.SetModel(clm)
+	sm.total = result.Total
 	return nil
 }
+
+// snippetMarkup turns a search.Snippet into Pango markup that fits on one line.
+var snippetMarkup = strings.NewReplacer(
+	search.SnippetMatchStart, "<b>",
+	search.SnippetMatchEnd, "</b>",
+	"\n", " ",
+)
@@ -12,12 +12,13 @@ type WindowMenu struct {
 	popover *PopoverMenu
 
 	zoomBox        *ZoomBox
+	offlineButton  *CheckModelButton
 	darkModeSwitch *DarkModeSwitch // may be nil
 }
 
 var _ Widget = &WindowMenu{}
 
-func NewWindowMenu(accels *gtk.AccelGroup, prefersAppMenu bool, darkModeGetter func() bool, darkModeSetter func(bool)) (*WindowMenu, error) {
+func NewWindowMenu(accels *gtk.AccelGroup, prefersAppMenu bool, darkModeGetter func() bool, darkModeSetter func(bool), offlineGetter func() bool, offlineSetter func(bool)) (*WindowMenu, error) {
 	super, err := gtk.MenuButtonNew()
 	if err != nil {
 		return nil, err
@@ -52,11 +53,17 @@ func NewWindowMenu(accels *gtk.AccelGroup, prefersAppMenu bool, darkModeGetter f
 		{l("Open link"), "win.open-link"},
 		{l("Explain"), "win.explain"},
 		{l("Properties"), "win.show-properties"},
+		{"", "sep"},
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	wm.offlineButton, err = wm.popover.AddCheckButton(l("Offline mode"), offlineGetter, offlineSetter)
+	if err != nil {
+		return nil, err
+	}
+
 	// If the desktop environment will show an app menu, then we do not need to
 	// add the app menu contents to the window menu.
 	if prefersAppMenu {
@@ -108,6 +115,8 @@ func (wm *WindowMenu) Dispose() {
 	wm.popover = nil
 	wm.zoomBox.Dispose()
 	wm.zoomBox = nil
+	wm.offlineButton.Dispose()
+	wm.offlineButton = nil
 	wm.darkModeSwitch.Dispose()
 	wm.darkModeSwitch = nil
 }